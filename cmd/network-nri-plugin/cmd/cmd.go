@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -10,7 +13,17 @@ import (
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by the main function.
 func Execute() {
-	if err := getRootCmd().Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// A second signal terminates the process without waiting for the
+	// graceful shutdown.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := getRootCmd().ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
@@ -27,6 +40,12 @@ func getRootCmd() *cobra.Command {
 	}
 
 	rootCmd.AddCommand(newCmdRun())
+	rootCmd.AddCommand(newCmdWebhook())
+	rootCmd.AddCommand(newCmdInspect())
+	rootCmd.AddCommand(newCmdValidate())
+	rootCmd.AddCommand(newCmdAttach())
+	rootCmd.AddCommand(newCmdDetach())
+	rootCmd.AddCommand(newCmdCheck())
 
 	return rootCmd
 }
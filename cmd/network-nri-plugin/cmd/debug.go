@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"github.com/kubernetes-sigs/multi-network/pkg/store"
+	"github.com/spf13/cobra"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// debugOptions are the options of the attach, detach and check commands
+// running the CNI flow of a claim against a network namespace, without
+// Kubernetes, NRI nor claim status update.
+type debugOptions struct {
+	ClaimFile     string
+	NetNS         string
+	IfName        string
+	ContainerID   string
+	PodName       string
+	PodNamespace  string
+	PodUID        string
+	CNIPath       string
+	CNICacheDir   string
+	ChrootDir     string
+	CNIExecMode   string
+	DRADriverName string
+}
+
+func newCmdAttach() *cobra.Command {
+	return newCmdDebug(
+		"attach",
+		"Attach the network of a claim to a network namespace",
+		`Run CNI ADD with the config of a ResourceClaim (or ResourceClaimTemplate) manifest against a network namespace and print the result`,
+		(*debugOptions).attach,
+	)
+}
+
+func newCmdDetach() *cobra.Command {
+	return newCmdDebug(
+		"detach",
+		"Detach the network of a claim from a network namespace",
+		`Run CNI DEL with the config of a ResourceClaim (or ResourceClaimTemplate) manifest against a network namespace`,
+		(*debugOptions).detach,
+	)
+}
+
+func newCmdCheck() *cobra.Command {
+	return newCmdDebug(
+		"check",
+		"Check the network of a claim attached to a network namespace",
+		`Run CNI CHECK with the config of a ResourceClaim (or ResourceClaimTemplate) manifest against a network namespace and print the result`,
+		(*debugOptions).check,
+	)
+}
+
+func newCmdDebug(use string, short string, long string, action func(*debugOptions, context.Context) error) *cobra.Command {
+	debugOpts := &debugOptions{}
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := action(debugOpts, cmd.Context()); err != nil {
+				fmt.Fprintf(os.Stderr, "%s failed: %v\n", use, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&debugOpts.ClaimFile,
+		"claim-file",
+		"",
+		"ResourceClaim or ResourceClaimTemplate manifest holding the network config.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.NetNS,
+		"netns",
+		"",
+		"Path of the network namespace (e.g. /var/run/netns/test).",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.IfName,
+		"ifname",
+		"",
+		"Interface name overriding the one of the claim config.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.ContainerID,
+		"container-id",
+		"",
+		"CNI container ID (defaults to one derived from the network namespace, so attach, check and detach match).",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.PodName,
+		"pod-name",
+		"debug",
+		"Pod name passed to the CNI plugins.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.PodNamespace,
+		"pod-namespace",
+		"default",
+		"Pod namespace passed to the CNI plugins.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.PodUID,
+		"pod-uid",
+		"",
+		"Pod UID passed to the CNI plugins (defaults to the container ID).",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.CNIPath,
+		"cni-path",
+		"/opt/cni/bin",
+		"CNI Path.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.CNICacheDir,
+		"cni-cache-dir",
+		filepath.Join(os.TempDir(), "network-nri-plugin-debug"),
+		"CNI Cache dir (kept apart from the cache of the daemon, the attach, check and detach commands must use the same).",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.ChrootDir,
+		"chroot-dir",
+		"/hostroot",
+		"ChrootDir.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.CNIExecMode,
+		"cni-exec-mode",
+		string(cniv1.ExecModeDirect),
+		"How the CNI plugins are executed: chroot (in --chroot-dir), direct or host-mountns.",
+	)
+
+	cmd.Flags().StringVar(
+		&debugOpts.DRADriverName,
+		"dra-driver-name",
+		"poc.dra.networking",
+		"DRA Driver Name.",
+	)
+
+	_ = cmd.MarkFlagRequired("claim-file")
+	_ = cmd.MarkFlagRequired("netns")
+
+	return cmd
+}
+
+func (do *debugOptions) attach(ctx context.Context) error {
+	cni, err := do.cni()
+	if err != nil {
+		return err
+	}
+
+	err = cni.AttachNetworks(ctx, do.ContainerID, do.PodUID, do.PodName, do.PodNamespace, do.NetNS)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(cni.Attachments())
+}
+
+func (do *debugOptions) detach(ctx context.Context) error {
+	cni, err := do.cni()
+	if err != nil {
+		return err
+	}
+
+	_, err = cni.DetachNetworks(ctx, do.ContainerID, do.PodUID, do.PodName, do.PodNamespace, do.NetNS)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, "network detached")
+
+	return nil
+}
+
+func (do *debugOptions) check(ctx context.Context) error {
+	cni, err := do.cni()
+	if err != nil {
+		return err
+	}
+
+	// The attachment is only known from the CNI cache in this process.
+	err = cni.LoadNetworks(ctx, do.ContainerID, do.PodUID, do.PodName, do.PodNamespace, do.NetNS)
+	if err != nil {
+		return err
+	}
+	if len(cni.Attachments()) == 0 {
+		return errors.New("network not attached (no CNI cache entry)")
+	}
+
+	checkErr := cni.CheckNetworks(ctx, do.PodUID)
+
+	if err := printJSON(cni.Attachments()); err != nil {
+		return err
+	}
+
+	return checkErr
+}
+
+// cni returns the CNI with the claim stored for the pod.
+func (do *debugOptions) cni() (*cniv1.CNI, error) {
+	if do.ContainerID == "" {
+		do.ContainerID = "network-nri-plugin-debug-" + filepath.Base(do.NetNS)
+	}
+	if do.PodUID == "" {
+		do.PodUID = do.ContainerID
+	}
+
+	execMode, err := cniv1.ParseExecMode(do.CNIExecMode)
+	if err != nil {
+		return nil, err
+	}
+
+	claim, err := do.loadClaim()
+	if err != nil {
+		return nil, err
+	}
+
+	cni := cniv1.New(
+		do.DRADriverName,
+		do.ChrootDir,
+		[]string{do.CNIPath},
+		do.CNICacheDir,
+		nil,
+		store.NewMemory(),
+		cniv1.WithExecMode(execMode),
+	)
+
+	if added := cni.AddNewPodResource(types.UID(do.PodUID), claim); !added {
+		return nil, fmt.Errorf("claim %s has no single network config for driver %s", do.ClaimFile, do.DRADriverName)
+	}
+
+	return cni, nil
+}
+
+// loadClaim reads the claim from the manifest. A claim without allocation
+// (or a claim template) gets allocated with its own configs, as the
+// scheduler would do.
+func (do *debugOptions) loadClaim() (*resourcev1beta1.ResourceClaim, error) {
+	data, err := os.ReadFile(do.ClaimFile)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := &resourcev1beta1.ResourceClaim{}
+	err = yaml.Unmarshal(data, claim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", do.ClaimFile, err)
+	}
+
+	if claim.Kind == "ResourceClaimTemplate" {
+		template := &resourcev1beta1.ResourceClaimTemplate{}
+		err = yaml.Unmarshal(data, template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", do.ClaimFile, err)
+		}
+		claim = &resourcev1beta1.ResourceClaim{
+			ObjectMeta: template.ObjectMeta,
+			Spec:       template.Spec.Spec,
+		}
+	}
+
+	if claim.Name == "" {
+		claim.Name = "debug"
+	}
+	if claim.Namespace == "" {
+		claim.Namespace = do.PodNamespace
+	}
+
+	if claim.Status.Allocation == nil {
+		if len(claim.Spec.Devices.Requests) == 0 {
+			return nil, fmt.Errorf("claim %s has no device request", do.ClaimFile)
+		}
+
+		allocation := &resourcev1beta1.AllocationResult{}
+		allocation.Devices.Results = []resourcev1beta1.DeviceRequestAllocationResult{{
+			Request: claim.Spec.Devices.Requests[0].Name,
+			Driver:  do.DRADriverName,
+			Pool:    "debug",
+			Device:  "debug",
+		}}
+		for _, config := range claim.Spec.Devices.Config {
+			allocation.Devices.Config = append(allocation.Devices.Config, resourcev1beta1.DeviceAllocationConfiguration{
+				Source:              resourcev1beta1.AllocationConfigSourceClaim,
+				Requests:            config.Requests,
+				DeviceConfiguration: config.DeviceConfiguration,
+			})
+		}
+		claim.Status.Allocation = allocation
+	}
+
+	if do.IfName != "" {
+		for _, config := range claim.Status.Allocation.Devices.Config {
+			if config.Opaque == nil || config.Opaque.Driver != do.DRADriverName {
+				continue
+			}
+
+			parameters := map[string]interface{}{}
+			err = json.Unmarshal(config.Opaque.Parameters.Raw, &parameters)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode the parameters of %s: %w", do.ClaimFile, err)
+			}
+			parameters["interface"] = do.IfName
+			config.Opaque.Parameters.Raw, err = json.Marshal(parameters)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return claim, nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/LionelJouin/network-dra/pkg/admin"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+type inspectOptions struct {
+	SocketPath string
+	Output     string
+	Check      bool
+}
+
+func newCmdInspect() *cobra.Command {
+	inspectOpts := &inspectOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Show the networks attached on the node",
+		Long:  `Show per pod the claims, interfaces, IPs, network namespace, CNI results and last CHECK status of the networks attached by the daemon running on the node`,
+		Run: func(cmd *cobra.Command, args []string) {
+			inspectOpts.run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&inspectOpts.SocketPath,
+		"admin-socket",
+		admin.DefaultSocketPath,
+		"Unix socket of the admin API of the running daemon.",
+	)
+
+	cmd.Flags().StringVarP(
+		&inspectOpts.Output,
+		"output",
+		"o",
+		"table",
+		"Output format: table, json or yaml.",
+	)
+
+	cmd.Flags().BoolVar(
+		&inspectOpts.Check,
+		"check",
+		false,
+		"Run the CNI CHECK of the networks before showing them.",
+	)
+
+	return cmd
+}
+
+func (ino *inspectOptions) run(ctx context.Context) {
+	attachments, err := admin.NewClient(ino.SocketPath).Attachments(ctx, ino.Check)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get the attachments: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = printAttachments(os.Stdout, ino.Output, attachments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print the attachments: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func printAttachments(w io.Writer, output string, attachments []cniv1.PodAttachment) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(attachments)
+	case "yaml":
+		out, err := yaml.Marshal(attachments)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case "table":
+		return printAttachmentsTable(w, attachments)
+	default:
+		return fmt.Errorf("unknown output format %q (supported: table, json, yaml)", output)
+	}
+}
+
+func printAttachmentsTable(w io.Writer, attachments []cniv1.PodAttachment) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tPOD\tCLAIM\tREQUEST\tINTERFACE\tIPS\tNETNS\tLAST CHECK")
+
+	for _, pod := range attachments {
+		for _, network := range pod.Networks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				pod.Namespace,
+				pod.Name,
+				network.Claim,
+				network.Request,
+				network.InterfaceName,
+				orNone(strings.Join(network.IPs, ",")),
+				pod.NetworkNamespace,
+				checkStatus(network.LastCheck),
+			)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func checkStatus(status *cniv1.CheckStatus) string {
+	if status == nil {
+		return "<none>"
+	}
+	if status.Error != "" {
+		return fmt.Sprintf("failed (%s): %s", status.Time.Format("15:04:05"), status.Error)
+	}
+	return fmt.Sprintf("ok (%s)", status.Time.Format("15:04:05"))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
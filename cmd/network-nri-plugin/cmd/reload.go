@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LionelJouin/network-dra/pkg/config"
+	"github.com/LionelJouin/network-dra/pkg/integrity"
+	"github.com/LionelJouin/network-dra/pkg/policy"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// defaultLogLevel is the log verbosity when none is configured.
+const defaultLogLevel = 0
+
+// reloadableOptions are the options applied again without restarting when
+// the configuration changes, the others require a restart.
+var reloadableOptions = sets.New(
+	"LogLevel",
+	"CNIAddTimeout",
+	"CNIDelTimeout",
+	"CNICheckTimeout",
+	"CNIGCTimeout",
+	"CNIPluginTimeouts",
+	"CNIVerification",
+	"CNIVerificationConfig",
+	"PolicyInline",
+)
+
+// reloader applies the configuration file and the configuration passed by
+// the container runtime (NRI Configure) on top of the flags, with the
+// precedence flags > runtime configuration > configuration file. Once
+// running, only the reloadable options are applied.
+type reloader struct {
+	flagOpts runOptions
+	flags    *pflag.FlagSet
+
+	// The components the reloadable options are applied to.
+	cni          *cniv1.CNI
+	policyEngine *policy.Engine
+	verifier     *integrity.Exec
+
+	mu            sync.Mutex
+	current       runOptions
+	fileConfig    *config.Configuration
+	runtimeConfig *config.Configuration
+}
+
+func newReloader(flagOpts runOptions, flags *pflag.FlagSet) *reloader {
+	return &reloader{
+		flagOpts: flagOpts,
+		flags:    flags,
+		current:  flagOpts,
+	}
+}
+
+// options returns the options of the flags and of the configurations.
+func (r *reloader) options() runOptions {
+	opts := r.flagOpts
+	if r.fileConfig != nil {
+		opts.applyConfig(r.fileConfig, r.flags)
+	}
+	if r.runtimeConfig != nil {
+		opts.applyConfig(r.runtimeConfig, r.flags)
+	}
+	return opts
+}
+
+// setFileConfig applies the configuration file after it changed.
+func (r *reloader) setFileConfig(ctx context.Context, cfg *config.Configuration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fileConfig = cfg
+	if err := r.apply(ctx); err != nil {
+		klog.FromContext(ctx).Error(err, "failed to reload the configuration file")
+	}
+}
+
+// setRuntimeConfig applies the configuration passed by the container
+// runtime, nil if the runtime passes none. The runtime configuration is
+// only received once the daemon is running, so it is rejected if it
+// changes options which are not reloadable.
+func (r *reloader) setRuntimeConfig(ctx context.Context, cfg *config.Configuration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.runtimeConfig
+
+	r.runtimeConfig = nil
+	withoutRuntimeConfig := r.options()
+	r.runtimeConfig = cfg
+	withRuntimeConfig := r.options()
+	if changed := withRuntimeConfig.changedOptions(&withoutRuntimeConfig); len(changed) > 0 {
+		r.runtimeConfig = previous
+		return fmt.Errorf("runtime configuration sets options which are not reloadable, set them with the flags or the configuration file instead: %s",
+			strings.Join(changed, ", "))
+	}
+	if err := r.apply(ctx); err != nil {
+		r.runtimeConfig = previous
+		return err
+	}
+
+	return nil
+}
+
+// apply applies the reloadable options which changed, the changes of the
+// other options are only logged. The lock must be held.
+func (r *reloader) apply(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+	next := r.options()
+
+	if changed := next.changedOptions(&r.current); len(changed) > 0 {
+		logger.Info("configuration changes not applied until restart", "options", changed)
+	}
+
+	err := next.reload(r)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("configuration reloaded")
+	r.current = next
+
+	return nil
+}
+
+// applyConfig sets the options from the configuration, except the ones
+// whose flag is set on the command line.
+func (ro *runOptions) applyConfig(cfg *config.Configuration, flags *pflag.FlagSet) {
+	setOption(flags, "dra-driver-name", &ro.DRADriverName, cfg.DRADriverName)
+	setOption(flags, "cni-path", &ro.CNIPath, cfg.CNI.Path)
+	setOption(flags, "cni-cache-dir", &ro.CNICacheDir, cfg.CNI.CacheDir)
+	setOption(flags, "chroot-dir", &ro.ChrootDir, cfg.CNI.ChrootDir)
+	setOption(flags, "cni-exec-mode", &ro.CNIExecMode, cfg.CNI.ExecMode)
+	setOption(flags, "cni-stderr-limit", &ro.CNIStderrLimit, cfg.CNI.StderrLimit)
+	setDurationOption(flags, "cni-add-timeout", &ro.CNIAddTimeout, cfg.CNI.Timeouts.Add)
+	setDurationOption(flags, "cni-del-timeout", &ro.CNIDelTimeout, cfg.CNI.Timeouts.Del)
+	setDurationOption(flags, "cni-check-timeout", &ro.CNICheckTimeout, cfg.CNI.Timeouts.Check)
+	setDurationOption(flags, "cni-gc-timeout", &ro.CNIGCTimeout, cfg.CNI.Timeouts.GC)
+	setOption(flags, "policy-configmap", &ro.PolicyConfigMap, cfg.Policy.ConfigMap)
+	setOption(flags, "metrics-address", &ro.MetricsAddress, cfg.MetricsAddress)
+	setOption(flags, "health-address", &ro.HealthAddress, cfg.HealthAddress)
+	setOption(flags, "admin-socket", &ro.AdminSocket, cfg.AdminSocket)
+	setDurationOption(flags, "shutdown-timeout", &ro.ShutdownTimeout, cfg.ShutdownTimeout)
+	setOption(flags, "tracing-endpoint", &ro.TracingEndpoint, cfg.Tracing.Endpoint)
+	setOption(flags, "tracing-insecure", &ro.TracingInsecure, cfg.Tracing.Insecure)
+	setOption(flags, "tracing-sampling-ratio", &ro.TracingSampling, cfg.Tracing.SamplingRatio)
+
+	if cfg.CNI.Timeouts.Plugins != nil && !flags.Changed("cni-plugin-timeouts") {
+		ro.CNIPluginTimeouts = map[string]string{}
+		for plugin, timeout := range cfg.CNI.Timeouts.Plugins {
+			ro.CNIPluginTimeouts[plugin] = timeout.Duration.String()
+		}
+	}
+
+	if cfg.CNI.BuiltinPlugins != nil && !flags.Changed("cni-builtin-plugins") {
+		ro.CNIBuiltinPlugins = cfg.CNI.BuiltinPlugins
+	}
+
+	if cfg.StatusSinks != nil && !flags.Changed("status-sinks") {
+		ro.StatusSinks = cfg.StatusSinks
+	}
+
+	if cfg.CNI.PluginVerification != nil && !flags.Changed("cni-plugin-verification-config") {
+		ro.CNIVerificationConfig = cfg.CNI.PluginVerification
+	}
+
+	if len(cfg.Policy.Inline) > 0 && !flags.Changed("policy-configmap") {
+		// Validated when the configuration is parsed.
+		ro.PolicyInline, _ = cfg.Policy.InlinePolicy()
+	}
+
+	if cfg.LogLevel != nil {
+		ro.LogLevel = cfg.LogLevel
+	}
+}
+
+func setOption[T any](flags *pflag.FlagSet, name string, option *T, value *T) {
+	if value != nil && !flags.Changed(name) {
+		*option = *value
+	}
+}
+
+func setDurationOption(flags *pflag.FlagSet, name string, option *time.Duration, value *metav1.Duration) {
+	if value != nil && !flags.Changed(name) {
+		*option = value.Duration
+	}
+}
+
+// changedOptions returns the options requiring a restart which differ from
+// the ones of previous.
+func (ro *runOptions) changedOptions(previous *runOptions) []string {
+	changed := []string{}
+	nextValue := reflect.ValueOf(ro).Elem()
+	previousValue := reflect.ValueOf(previous).Elem()
+
+	for i := 0; i < nextValue.NumField(); i++ {
+		field := nextValue.Type().Field(i)
+		if !field.IsExported() || reloadableOptions.Has(field.Name) {
+			continue
+		}
+		if !reflect.DeepEqual(nextValue.Field(i).Interface(), previousValue.Field(i).Interface()) {
+			changed = append(changed, field.Name)
+		}
+	}
+
+	return changed
+}
+
+// reload applies the reloadable options to the running components.
+func (ro *runOptions) reload(r *reloader) error {
+	timeouts, err := ro.execTimeouts()
+	if err != nil {
+		return err
+	}
+
+	verificationConfig, err := ro.verificationConfig()
+	if err != nil {
+		return err
+	}
+
+	// The log level is only set when it changed, so the one set with the
+	// admin API is kept until then. It is reset to the default once
+	// removed from the configurations.
+	if logLevel := ro.logLevel(); logLevel != r.current.logLevel() {
+		if err := setLogLevel(logLevel); err != nil {
+			return err
+		}
+	}
+
+	r.cni.SetExecTimeouts(timeouts)
+	r.verifier.SetConfig(verificationConfig)
+
+	// A policy stored in a ConfigMap is kept in sync by the engine itself.
+	if ro.PolicyConfigMap == "" {
+		r.policyEngine.SetPolicy(ro.PolicyInline)
+	}
+
+	return nil
+}
+
+// logLevel returns the log verbosity of the options.
+func (ro *runOptions) logLevel() int {
+	if ro.LogLevel != nil {
+		return *ro.LogLevel
+	}
+	return defaultLogLevel
+}
+
+// setLogLevel sets the log verbosity (-v).
+func setLogLevel(verbosity int) error {
+	var level klog.Level
+	return level.Set(strconv.Itoa(verbosity))
+}
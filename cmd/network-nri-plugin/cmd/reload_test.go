@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/LionelJouin/network-dra/pkg/config"
+	"github.com/LionelJouin/network-dra/pkg/integrity"
+	"github.com/LionelJouin/network-dra/pkg/policy"
+	"github.com/LionelJouin/network-dra/pkg/status"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"github.com/kubernetes-sigs/multi-network/pkg/store"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+)
+
+// testFlags returns the options of a subset of the run flags parsed from
+// args.
+func testFlags(t *testing.T, args ...string) (runOptions, *pflag.FlagSet) {
+	t.Helper()
+	opts := runOptions{}
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	flags.DurationVar(&opts.CNIAddTimeout, "cni-add-timeout", time.Minute, "")
+	flags.DurationVar(&opts.CNIDelTimeout, "cni-del-timeout", time.Minute, "")
+	flags.StringVar(&opts.CNIExecMode, "cni-exec-mode", string(cniv1.ExecModeChroot), "")
+	flags.StringToStringVar(&opts.CNIPluginTimeouts, "cni-plugin-timeouts", map[string]string{}, "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return opts, flags
+}
+
+func parseConfig(t *testing.T, data string) *config.Configuration {
+	t.Helper()
+	if data == "" {
+		return nil
+	}
+	cfg, err := config.Parse([]byte("apiVersion: " + config.APIVersion + "\nkind: " + config.Kind + "\n" + data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestReloaderOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		fileConfig    string
+		runtimeConfig string
+		wantAdd       time.Duration
+		wantDel       time.Duration
+		wantExecMode  string
+		wantLogLevel  int
+	}{
+		{
+			name:         "defaults",
+			wantAdd:      time.Minute,
+			wantDel:      time.Minute,
+			wantExecMode: "chroot",
+		},
+		{
+			name:         "file",
+			fileConfig:   "logLevel: 2\ncni:\n  execMode: direct\n  timeouts:\n    add: 10s\n",
+			wantAdd:      10 * time.Second,
+			wantDel:      time.Minute,
+			wantExecMode: "direct",
+			wantLogLevel: 2,
+		},
+		{
+			name:          "runtime over file",
+			fileConfig:    "logLevel: 2\ncni:\n  timeouts:\n    add: 10s\n    del: 10s\n",
+			runtimeConfig: "logLevel: 3\ncni:\n  timeouts:\n    add: 20s\n",
+			wantAdd:       20 * time.Second,
+			wantDel:       10 * time.Second,
+			wantExecMode:  "chroot",
+			wantLogLevel:  3,
+		},
+		{
+			name:          "flags over runtime and file",
+			args:          []string{"--cni-add-timeout=30s", "--cni-exec-mode=host-mountns"},
+			fileConfig:    "cni:\n  execMode: direct\n  timeouts:\n    add: 10s\n",
+			runtimeConfig: "cni:\n  timeouts:\n    add: 20s\n",
+			wantAdd:       30 * time.Second,
+			wantDel:       time.Minute,
+			wantExecMode:  "host-mountns",
+		},
+		{
+			name:          "runtime without file",
+			runtimeConfig: "cni:\n  timeouts:\n    del: 20s\n",
+			wantAdd:       time.Minute,
+			wantDel:       20 * time.Second,
+			wantExecMode:  "chroot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, flags := testFlags(t, tt.args...)
+			r := newReloader(opts, flags)
+			r.fileConfig = parseConfig(t, tt.fileConfig)
+			r.runtimeConfig = parseConfig(t, tt.runtimeConfig)
+
+			got := r.options()
+			if got.CNIAddTimeout != tt.wantAdd {
+				t.Errorf("CNIAddTimeout = %s, want %s", got.CNIAddTimeout, tt.wantAdd)
+			}
+			if got.CNIDelTimeout != tt.wantDel {
+				t.Errorf("CNIDelTimeout = %s, want %s", got.CNIDelTimeout, tt.wantDel)
+			}
+			if got.CNIExecMode != tt.wantExecMode {
+				t.Errorf("CNIExecMode = %s, want %s", got.CNIExecMode, tt.wantExecMode)
+			}
+			if got.logLevel() != tt.wantLogLevel {
+				t.Errorf("log level = %d, want %d", got.logLevel(), tt.wantLogLevel)
+			}
+		})
+	}
+}
+
+func TestReloaderStatusSinks(t *testing.T) {
+	opts, flags := testFlags(t)
+	opts.StatusSinks = status.Sinks
+	r := newReloader(opts, flags)
+	r.fileConfig = parseConfig(t, "statusSinks: [events]\n")
+
+	if got := r.options().StatusSinks; !slices.Equal(got, []string{status.SinkEvents}) {
+		t.Errorf("StatusSinks = %v, want [%s]", got, status.SinkEvents)
+	}
+
+	_, err := config.Parse([]byte("apiVersion: " + config.APIVersion + "\nkind: " + config.Kind + "\nstatusSinks: [syslog]\n"))
+	if err == nil {
+		t.Error("config.Parse() error = nil, want the unknown status sink rejected")
+	}
+}
+
+// testReloader returns a reloader applying the options to actual
+// components.
+func testReloader(t *testing.T, args ...string) *reloader {
+	t.Helper()
+	opts, flags := testFlags(t, args...)
+	r := newReloader(opts, flags)
+	r.cni = cniv1.New("poc.dra.networking", "/", []string{t.TempDir()}, t.TempDir(), nil, store.NewMemory())
+	r.policyEngine = policy.NewEngine("poc.dra.networking")
+	r.verifier = integrity.NewExec(nil, nil, "/")
+	return r
+}
+
+func TestReloaderFieldRemoved(t *testing.T) {
+	r := testReloader(t)
+	t.Cleanup(func() {
+		_ = setLogLevel(defaultLogLevel)
+	})
+	ctx := context.Background()
+
+	r.setFileConfig(ctx, parseConfig(t, "logLevel: 4\ncni:\n  timeouts:\n    add: 10s\n"))
+	if !klog.V(4).Enabled() || r.current.CNIAddTimeout != 10*time.Second {
+		t.Fatalf("file configuration not applied: log level enabled %t, add timeout %s", klog.V(4).Enabled(), r.current.CNIAddTimeout)
+	}
+
+	// The removed fields get back their default.
+	r.setFileConfig(ctx, parseConfig(t, "cni:\n  timeouts:\n    del: 10s\n"))
+	if klog.V(1).Enabled() {
+		t.Errorf("log level not reset to the default once removed")
+	}
+	if r.current.CNIAddTimeout != time.Minute {
+		t.Errorf("CNIAddTimeout = %s, want the default %s", r.current.CNIAddTimeout, time.Minute)
+	}
+}
+
+func TestSetRuntimeConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		runtimeConfig string
+		wantErr       bool
+		wantAdd       time.Duration
+	}{
+		{
+			name:          "reloadable options",
+			runtimeConfig: "cni:\n  timeouts:\n    add: 20s\n",
+			wantAdd:       20 * time.Second,
+		},
+		{
+			name:          "option not reloadable",
+			runtimeConfig: "cni:\n  execMode: direct\n  timeouts:\n    add: 20s\n",
+			wantErr:       true,
+			wantAdd:       time.Minute,
+		},
+		{
+			name:          "option not reloadable unchanged",
+			runtimeConfig: "cni:\n  execMode: chroot\n  timeouts:\n    add: 20s\n",
+			wantAdd:       20 * time.Second,
+		},
+		{
+			name:          "option not reloadable overridden by a flag",
+			args:          []string{"--cni-exec-mode=host-mountns"},
+			runtimeConfig: "cni:\n  execMode: direct\n",
+			wantAdd:       time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReloader(t, tt.args...)
+
+			err := r.setRuntimeConfig(context.Background(), parseConfig(t, tt.runtimeConfig))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setRuntimeConfig() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr && r.runtimeConfig != nil {
+				t.Errorf("rejected runtime configuration kept")
+			}
+			if r.current.CNIAddTimeout != tt.wantAdd {
+				t.Errorf("CNIAddTimeout = %s, want %s", r.current.CNIAddTimeout, tt.wantAdd)
+			}
+		})
+	}
+}
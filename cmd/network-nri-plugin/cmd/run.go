@@ -4,26 +4,81 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/LionelJouin/network-dra/pkg/admin"
+	"github.com/LionelJouin/network-dra/pkg/builtin"
+	"github.com/LionelJouin/network-dra/pkg/cdi"
+	"github.com/LionelJouin/network-dra/pkg/config"
+	"github.com/LionelJouin/network-dra/pkg/devices"
+	"github.com/LionelJouin/network-dra/pkg/health"
+	"github.com/LionelJouin/network-dra/pkg/integrity"
+	"github.com/LionelJouin/network-dra/pkg/metrics"
 	"github.com/LionelJouin/network-dra/pkg/nri"
+	"github.com/LionelJouin/network-dra/pkg/policy"
 	"github.com/LionelJouin/network-dra/pkg/status"
+	"github.com/LionelJouin/network-dra/pkg/tracing"
+	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
+	"github.com/containernetworking/cni/pkg/invoke"
 	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
 	"github.com/kubernetes-sigs/multi-network/pkg/dra"
 	"github.com/kubernetes-sigs/multi-network/pkg/store"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 )
 
 type runOptions struct {
-	pluginName    string
-	pluginIndex   string
-	CNIPath       string
-	CNICacheDir   string
-	ChrootDir     string
-	DRADriverName string
-	NodeName      string
+	pluginName        string
+	pluginIndex       string
+	CNIPath           string
+	CNICacheDir       string
+	ChrootDir         string
+	CNIExecMode       string
+	DRADriverName     string
+	NodeName          string
+	CNIAddTimeout     time.Duration
+	CNIDelTimeout     time.Duration
+	CNICheckTimeout   time.Duration
+	CNIGCTimeout      time.Duration
+	CNIPluginTimeouts map[string]string
+	CNIStderrLimit    int
+	CNIBuiltinPlugins []string
+	CNIVerification   string
+	PolicyConfigMap   string
+	StatusSinks       []string
+	MetricsAddress    string
+	HealthAddress     string
+	ShutdownTimeout   time.Duration
+	TracingEndpoint   string
+	TracingInsecure   bool
+	TracingSampling   float64
+	AdminSocket       string
+	Kubeconfig        string
+	KubeletRegistry   string
+	KubeletPlugins    string
+	NRISocket         string
+	DRANodeAPIs       []string
+	CDISpecDir        string
+	NetworkInfoDir    string
+	PodInfoDir        string
+	HostRoot          string
+	AllowedDevices    []string
+	ConfigFile        string
+	// The fields below are only set by the configuration file.
+	LogLevel              *int
+	PolicyInline          *policy.Policy
+	CNIVerificationConfig *integrity.Config
 }
 
 func newCmdRun() *cobra.Command {
@@ -34,10 +89,17 @@ func newCmdRun() *cobra.Command {
 		Short: "Run the network-nri-plugin",
 		Long:  `Run the network-nri-plugin`,
 		Run: func(cmd *cobra.Command, args []string) {
-			runOpts.run(cmd.Context())
+			runOpts.run(cmd.Context(), cmd.Flags())
 		},
 	}
 
+	cmd.Flags().StringVar(
+		&runOpts.ConfigFile,
+		"config",
+		"",
+		"Configuration file (the flags set on the command line override it), the timeouts, log level, inline policy and plugin verification are reloaded when it changes.",
+	)
+
 	cmd.Flags().StringVar(
 		&runOpts.pluginName,
 		"plugin-name",
@@ -73,6 +135,41 @@ func newCmdRun() *cobra.Command {
 		"ChrootDir.",
 	)
 
+	cmd.Flags().StringVar(
+		&runOpts.CNIExecMode,
+		"cni-exec-mode",
+		string(cniv1.ExecModeChroot),
+		"How the CNI plugins are executed: chroot (in --chroot-dir), direct (from the container filesystem) or host-mountns (in the host mount namespace, requires hostPID).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.NRISocket,
+		"nri-socket",
+		api.DefaultSocketPath,
+		"NRI socket of the container runtime.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.Kubeconfig,
+		"kubeconfig",
+		"",
+		"Kubeconfig file to run out of the cluster (e.g. as a systemd service), the in-cluster config is used if empty.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.KubeletRegistry,
+		"kubelet-registry-dir",
+		"/var/lib/kubelet/plugins_registry",
+		"Directory the kubelet watches for the plugin registration sockets.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.KubeletPlugins,
+		"kubelet-plugins-dir",
+		"/var/lib/kubelet/plugins",
+		"Directory of the kubelet plugin sockets.",
+	)
+
 	cmd.Flags().StringVar(
 		&runOpts.DRADriverName,
 		"dra-driver-name",
@@ -80,6 +177,48 @@ func newCmdRun() *cobra.Command {
 		"DRA Driver Name.",
 	)
 
+	cmd.Flags().StringSliceVar(
+		&runOpts.DRANodeAPIs,
+		"dra-node-api-versions",
+		[]string{dra.NodeAPIV1alpha4, dra.NodeAPIV1beta1},
+		"Versions of the kubelet DRA gRPC API served (v1alpha4 for Kubernetes 1.31, v1beta1 for 1.32+).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.CDISpecDir,
+		"cdi-spec-dir",
+		"/var/run/cdi",
+		"Directory the CDI specs exposing the networks of the claims to the containers are written to (disabled if empty).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.NetworkInfoDir,
+		"network-info-dir",
+		"/var/run/network-nri-plugin/claims",
+		"Host directory of the network info files mounted in the containers by the CDI specs.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.PodInfoDir,
+		"pod-info-dir",
+		"/var/run/network-nri-plugin/pods",
+		"Host directory of the network info files of the pods mounted in their containers on CreateContainer (not mounted if empty).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.HostRoot,
+		"host-root",
+		"/",
+		"Directory the host root is accessible at, the device nodes added to the containers are looked up under it.",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&runOpts.AllowedDevices,
+		"allowed-device-nodes",
+		devices.DefaultAllowedDeviceNodes,
+		"Patterns of the device nodes which can be added to the containers from the ResourceSlice attributes, the others are rejected.",
+	)
+
 	cmd.Flags().StringVar(
 		&runOpts.NodeName,
 		"node-name",
@@ -87,18 +226,170 @@ func newCmdRun() *cobra.Command {
 		"Node Name.",
 	)
 
+	cmd.Flags().DurationVar(
+		&runOpts.CNIAddTimeout,
+		"cni-add-timeout",
+		time.Minute,
+		"Timeout of the CNI ADD plugin executions (0 to disable).",
+	)
+
+	cmd.Flags().DurationVar(
+		&runOpts.CNIDelTimeout,
+		"cni-del-timeout",
+		time.Minute,
+		"Timeout of the CNI DEL plugin executions (0 to disable).",
+	)
+
+	cmd.Flags().DurationVar(
+		&runOpts.CNICheckTimeout,
+		"cni-check-timeout",
+		30*time.Second,
+		"Timeout of the CNI CHECK plugin executions (0 to disable).",
+	)
+
+	cmd.Flags().DurationVar(
+		&runOpts.CNIGCTimeout,
+		"cni-gc-timeout",
+		30*time.Second,
+		"Timeout of the CNI GC plugin executions (0 to disable).",
+	)
+
+	cmd.Flags().StringToStringVar(
+		&runOpts.CNIPluginTimeouts,
+		"cni-plugin-timeouts",
+		map[string]string{},
+		"Timeouts overriding the command timeouts per plugin type (e.g. dhcp=2m,dhcp/DEL=10s).",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&runOpts.CNIBuiltinPlugins,
+		"cni-builtin-plugins",
+		[]string{},
+		"CNI plugin types executed in-process by their built-in implementation instead of their binary (supported: loopback).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.CNIVerification,
+		"cni-plugin-verification-config",
+		"",
+		"Path of the file listing the CNI plugin types allowed to be executed and the SHA-256 digests of their binary (disabled if empty). Only the plugins executed by the driver are verified, not the IPAM and delegated plugins they execute.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.PolicyConfigMap,
+		"policy-configmap",
+		"",
+		"ConfigMap (namespace/name) holding the policy restricting per namespace the CNI configs the claims can use (disabled if empty).",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&runOpts.StatusSinks,
+		"status-sinks",
+		status.Sinks,
+		"Where the status of the networks is reported: claim-status (CNI results in the ResourceClaim status) and events (Events on the pods and ResourceClaims).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.MetricsAddress,
+		"metrics-address",
+		":9680",
+		"Address the Prometheus metrics (/metrics) are served on (disabled if empty).",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.HealthAddress,
+		"health-address",
+		":9681",
+		"Address the liveness (/healthz) and readiness (/readyz) endpoints are served on (disabled if empty).",
+	)
+
+	cmd.Flags().DurationVar(
+		&runOpts.ShutdownTimeout,
+		"shutdown-timeout",
+		20*time.Second,
+		"Maximum duration waited on SIGTERM/SIGINT for the in-flight NRI events to finish.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.TracingEndpoint,
+		"tracing-endpoint",
+		"",
+		"Endpoint (host:port) of the OTLP gRPC collector the traces are exported to (disabled if empty).",
+	)
+
+	cmd.Flags().BoolVar(
+		&runOpts.TracingInsecure,
+		"tracing-insecure",
+		false,
+		"Connect to the OTLP collector without TLS.",
+	)
+
+	cmd.Flags().Float64Var(
+		&runOpts.TracingSampling,
+		"tracing-sampling-ratio",
+		1,
+		"Ratio (from 0 to 1) of the traces sampled.",
+	)
+
+	cmd.Flags().StringVar(
+		&runOpts.AdminSocket,
+		"admin-socket",
+		admin.DefaultSocketPath,
+		"Unix socket the local admin API (used by e.g. the inspect command) is served on (disabled if empty).",
+	)
+
+	cmd.Flags().IntVar(
+		&runOpts.CNIStderrLimit,
+		"cni-stderr-limit",
+		4096,
+		"Maximum number of bytes of the CNI plugin stderr kept in the logs and errors (0 for no limit).",
+	)
+
 	return cmd
 }
 
-func (ro *runOptions) run(ctx context.Context) {
+func (ro *runOptions) run(ctx context.Context, flags *pflag.FlagSet) {
+	configReloader := newReloader(*ro, flags)
+
+	if ro.ConfigFile != "" {
+		cfg, err := config.Load(ro.ConfigFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load the configuration file: %v\n", err)
+			os.Exit(1)
+		}
+		configReloader.fileConfig = cfg
+		*ro = configReloader.options()
+		configReloader.current = *ro
+	}
+
+	if ro.LogLevel != nil {
+		if err := setLogLevel(*ro.LogLevel); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid log level: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	opts := []stub.Option{
 		stub.WithPluginName(ro.pluginName),
 		stub.WithPluginIdx(ro.pluginIndex),
+		stub.WithSocketPath(ro.NRISocket),
+	}
+
+	cniOpts, err := ro.cniOptions(configReloader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid CNI options: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = status.ValidateSinks(ro.StatusSinks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid status sinks: %v\n", err)
+		os.Exit(1)
 	}
 
-	clientCfg, err := rest.InClusterConfig()
+	clientCfg, err := ro.clientConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to InClusterConfig: %v\n", err)
+		fmt.Fprintf(os.Stderr, "failed to get the client config: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -108,7 +399,74 @@ func (ro *runOptions) run(ctx context.Context) {
 		os.Exit(1)
 	}
 
+	if ro.TracingEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+			Endpoint:      ro.TracingEndpoint,
+			Insecure:      ro.TracingInsecure,
+			SamplingRatio: ro.TracingSampling,
+			ServiceName:   ro.pluginName,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to set up tracing: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			// Flush the pending spans.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = shutdownTracing(shutdownCtx)
+		}()
+	}
+
+	if ro.MetricsAddress != "" {
+		go func() {
+			if err := metrics.ListenAndServe(ctx, ro.MetricsAddress); err != nil {
+				klog.FromContext(ctx).Error(err, "metrics server exited with error")
+			}
+		}()
+	}
+
+	draOpts := []dra.Option{
+		dra.WithKubeletRegistryDir(ro.KubeletRegistry),
+		dra.WithKubeletPluginsDir(ro.KubeletPlugins),
+		dra.WithNodeAPIVersions(ro.DRANodeAPIs...),
+		dra.WithRequestObserver(func(method string, duration time.Duration, err error) {
+			metrics.DRARequests.WithLabelValues(method, metrics.Result(err)).Inc()
+			metrics.DRARequestDuration.WithLabelValues(method).Observe(duration.Seconds())
+		}),
+	}
+
+	if ro.PolicyConfigMap != "" {
+		policyNamespace, policyName, found := strings.Cut(ro.PolicyConfigMap, "/")
+		if !found {
+			fmt.Fprintf(os.Stderr, "invalid policy configmap %q: expected namespace/name\n", ro.PolicyConfigMap)
+			os.Exit(1)
+		}
+
+		configReloader.policyEngine = policy.NewEngine(ro.DRADriverName)
+		go configReloader.policyEngine.Run(ctx, clientset, policyNamespace, policyName)
+	} else {
+		// The inline policy can be set or removed by a reload, no policy
+		// does not restrict the claims.
+		configReloader.policyEngine = policy.NewEngine(ro.DRADriverName)
+		configReloader.policyEngine.SetPolicy(ro.PolicyInline)
+	}
+
+	var cdiHandler *cdi.Handler
+	if ro.CDISpecDir != "" {
+		podInfoPath := ""
+		if ro.PodInfoDir != "" {
+			podInfoPath = nri.PodInfoContainerPath
+		}
+		cdiHandler = cdi.NewHandler(ro.DRADriverName, ro.CDISpecDir, ro.NetworkInfoDir, podInfoPath)
+		draOpts = append(draOpts, dra.WithCDIHandler(cdiHandler))
+	}
+
+	draOpts = append(draOpts, dra.WithClaimValidator(configReloader.policyEngine.ValidateClaim))
+	cniOpts = append(cniOpts, cniv1.WithClaimValidator(configReloader.policyEngine.ValidateClaim))
+
 	memoryStore := store.NewMemory()
+	metrics.RegisterStoreSize(memoryStore.Len)
 
 	draDriver, err := dra.Start(
 		ctx,
@@ -116,15 +474,33 @@ func (ro *runOptions) run(ctx context.Context) {
 		ro.NodeName,
 		clientset,
 		memoryStore,
+		draOpts...,
 	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to dra.Start: %v\n", err)
 		os.Exit(1)
 	}
-	defer draDriver.Stop()
 
-	cnish := status.CNIStatusHandler{
-		ClientSet: clientset,
+	var updateStatus cniv1.UpdateStatus
+	if slices.Contains(ro.StatusSinks, status.SinkClaimStatus) {
+		cnish := status.CNIStatusHandler{
+			ClientSet: clientset,
+		}
+		updateStatus = cnish.UpdateStatus
+	}
+
+	if slices.Contains(ro.StatusSinks, status.SinkEvents) {
+		eventBroadcaster := record.NewBroadcaster(record.WithContext(ctx))
+		eventBroadcaster.StartStructuredLogging(0)
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+			Interface: clientset.CoreV1().Events(""),
+		})
+		defer eventBroadcaster.Shutdown()
+
+		cniOpts = append(cniOpts, cniv1.WithEventRecorder(eventBroadcaster.NewRecorder(
+			scheme.Scheme,
+			corev1.EventSource{Component: ro.DRADriverName, Host: ro.NodeName},
+		)))
 	}
 
 	cni := cniv1.New(
@@ -132,24 +508,204 @@ func (ro *runOptions) run(ctx context.Context) {
 		ro.ChrootDir,
 		[]string{ro.CNIPath},
 		ro.CNICacheDir,
-		cnish.UpdateStatus,
+		updateStatus,
 		memoryStore,
+		cniOpts...,
 	)
+	configReloader.cni = cni
 
-	p := &nri.Plugin{
-		ClientSet: clientset,
-		CNI:       cni,
+	if ro.ConfigFile != "" {
+		go func() {
+			err := config.Watch(ctx, ro.ConfigFile, func(cfg *config.Configuration) {
+				configReloader.setFileConfig(ctx, cfg)
+			})
+			if err != nil {
+				klog.FromContext(ctx).Error(err, "configuration file not watched, its changes require a restart")
+			}
+		}()
 	}
 
-	p.Stub, err = stub.New(p, opts...)
+	deviceInjector, err := devices.NewInjector(clientset, ro.DRADriverName, ro.NodeName, ro.HostRoot, ro.AllowedDevices)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create plugin stub: %v\n", err)
+		fmt.Fprintf(os.Stderr, "failed to devices.NewInjector: %v\n", err)
 		os.Exit(1)
 	}
 
-	err = p.Stub.Run(ctx)
+	go deviceInjector.Run(ctx)
+
+	p := &nri.Plugin{
+		ClientSet:   clientset,
+		CNI:         cni,
+		PodInfoDir:  ro.PodInfoDir,
+		Claims:      memoryStore,
+		Devices:     deviceInjector,
+		OnConfigure: configReloader.setRuntimeConfig,
+	}
+
+	if ro.AdminSocket != "" {
+		adminServer := &admin.Server{
+			CNI:   cni,
+			Store: memoryStore,
+			// The in-flight operations are drained with the NRI events.
+			InFlight: p.InFlight,
+		}
+
+		go func() {
+			if err := admin.ListenAndServe(ctx, ro.AdminSocket, adminServer.Handler()); err != nil {
+				klog.FromContext(ctx).Error(err, "admin server exited with error")
+			}
+		}()
+	}
+
+	if ro.HealthAddress != "" {
+		checker := health.NewChecker(5 * time.Second)
+		checker.AddLivenessCheck("dra-registration", draDriver.CheckRegistration)
+		checker.SetInfo("dra-services", strings.Join(draDriver.NodeServices(), ","))
+		// The NRI connection is re-established by the plugin, so it does
+		// not require a restart.
+		checker.AddReadinessCheck("nri", p.CheckConnection)
+		checker.AddReadinessCheck("apiserver", func(ctx context.Context) error {
+			return clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+		})
+		// The store is in memory, the check only verifies it is not
+		// locked up.
+		checker.AddReadinessCheck("store", func(context.Context) error {
+			memoryStore.Len()
+			return nil
+		})
+
+		go func() {
+			if err := health.ListenAndServe(ctx, ro.HealthAddress, checker); err != nil {
+				klog.FromContext(ctx).Error(err, "health server exited with error")
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		klog.Background().Info("shutting down", "timeout", ro.ShutdownTimeout)
+		if err := p.Stop(ro.ShutdownTimeout); err != nil {
+			klog.Background().Error(err, "failed to drain the NRI events")
+		}
+	}()
+
+	err = p.Run(ctx, opts...)
+
+	// The kubelet plugin keeps serving until the NRI events are drained
+	// since they rely on the claims it prepared. The store is in memory,
+	// there is nothing to flush.
+	draDriver.Stop()
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "plugin exited with error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// clientConfig returns the config of the kubeconfig file if set, the
+// in-cluster one otherwise.
+func (ro *runOptions) clientConfig() (*rest.Config, error) {
+	if ro.Kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", ro.Kubeconfig)
+	}
+	return rest.InClusterConfig()
+}
+
+func (ro *runOptions) cniOptions(configReloader *reloader) ([]cniv1.Option, error) {
+	execMode, err := cniv1.ParseExecMode(ro.CNIExecMode)
+	if err != nil {
+		return nil, err
+	}
+
+	execTimeouts, err := ro.execTimeouts()
+	if err != nil {
+		return nil, err
+	}
+
+	cniOpts := []cniv1.Option{
+		cniv1.WithExecMode(execMode),
+		cniv1.WithExecTimeouts(execTimeouts),
+		cniv1.WithStderrLimit(ro.CNIStderrLimit),
+	}
+
+	// The plugin binaries are verified before being executed, the built-in
+	// plugins are not binaries so they are dispatched before the verification.
+	// The verification is disabled while there is no config, a reload can
+	// enable it.
+	verificationConfig, err := ro.verificationConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cniOpts = append(cniOpts, cniv1.WithExecWrapper(func(exec invoke.Exec) invoke.Exec {
+		configReloader.verifier = integrity.NewExec(exec, verificationConfig, execMode.Root(ro.ChrootDir))
+		return configReloader.verifier
+	}))
+
+	builtinPlugins, err := ro.builtinPlugins()
+	if err != nil {
+		return nil, err
+	}
+
+	cniOpts = append(cniOpts, cniv1.WithExecWrapper(func(exec invoke.Exec) invoke.Exec {
+		return builtin.NewExec(exec, builtinPlugins)
+	}))
+
+	// Outermost so the built-in and rejected plugins are recorded too.
+	cniOpts = append(cniOpts,
+		cniv1.WithExecWrapper(func(exec invoke.Exec) invoke.Exec {
+			return metrics.NewExec(exec)
+		}),
+		cniv1.WithExecRetryObserver(func(pluginType string) {
+			metrics.CNIExecRetries.WithLabelValues(pluginType).Inc()
+		}),
+	)
+
+	return cniOpts, nil
+}
+
+func (ro *runOptions) execTimeouts() (cniv1.Timeouts, error) {
+	timeouts := cniv1.Timeouts{
+		Commands: map[string]time.Duration{
+			"ADD":   ro.CNIAddTimeout,
+			"DEL":   ro.CNIDelTimeout,
+			"CHECK": ro.CNICheckTimeout,
+			"GC":    ro.CNIGCTimeout,
+		},
+		Plugins: map[string]time.Duration{},
+	}
+
+	for plugin, value := range ro.CNIPluginTimeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return timeouts, fmt.Errorf("failed to parse timeout of plugin %s: %w", plugin, err)
+		}
+		timeouts.Plugins[plugin] = timeout
+	}
+
+	return timeouts, nil
+}
+
+// verificationConfig returns the plugin verification config of the file
+// set by flag or the one of the configuration file, nil if none.
+func (ro *runOptions) verificationConfig() (*integrity.Config, error) {
+	if ro.CNIVerification != "" {
+		return integrity.LoadConfig(ro.CNIVerification)
+	}
+	return ro.CNIVerificationConfig, nil
+}
+
+func (ro *runOptions) builtinPlugins() (map[string]builtin.Plugin, error) {
+	available := builtin.Available()
+	plugins := map[string]builtin.Plugin{}
+
+	for _, pluginType := range ro.CNIBuiltinPlugins {
+		plugin, exists := available[pluginType]
+		if !exists {
+			return nil, fmt.Errorf("no built-in implementation of plugin %s", pluginType)
+		}
+		plugins[pluginType] = plugin
+	}
+
+	return plugins, nil
+}
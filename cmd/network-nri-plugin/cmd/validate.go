@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/LionelJouin/network-dra/pkg/validation"
+	"github.com/spf13/cobra"
+)
+
+type validateOptions struct {
+	Files         []string
+	DRADriverName string
+	CNIBinDirs    []string
+}
+
+func newCmdValidate() *cobra.Command {
+	validateOpts := &validateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate claim, claim template and device class manifests",
+		Long:  `Validate offline the network configs of the ResourceClaim, ResourceClaimTemplate and DeviceClass manifests with the same checks as the node`,
+		Run: func(cmd *cobra.Command, args []string) {
+			validateOpts.run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(
+		&validateOpts.Files,
+		"filename",
+		"f",
+		[]string{},
+		"Manifest files or directories (walked for .yaml, .yml and .json files) to validate, - for the standard input.",
+	)
+
+	cmd.Flags().StringVar(
+		&validateOpts.DRADriverName,
+		"dra-driver-name",
+		"poc.dra.networking",
+		"DRA Driver Name.",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&validateOpts.CNIBinDirs,
+		"cni-bin-dir",
+		[]string{},
+		"Directories the CNI plugins of the configs must be found in (not checked if empty).",
+	)
+
+	return cmd
+}
+
+func (vo *validateOptions) run(_ context.Context) {
+	if len(vo.Files) == 0 {
+		fmt.Fprintf(os.Stderr, "no manifest to validate, use -f\n")
+		os.Exit(1)
+	}
+
+	opts := validation.ManifestOptions{
+		DriverName: vo.DRADriverName,
+		CNIPath:    vo.CNIBinDirs,
+	}
+
+	invalid := false
+	for _, file := range vo.Files {
+		manifestErrs, err := validateManifests(file, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			invalid = true
+		}
+		for _, manifestErr := range manifestErrs {
+			fmt.Fprintln(os.Stdout, manifestErr.Error())
+			invalid = true
+		}
+	}
+
+	if invalid {
+		os.Exit(1)
+	}
+}
+
+// validateManifests validates the manifest file, or the manifest files in
+// the directory.
+func validateManifests(path string, opts validation.ManifestOptions) ([]validation.ManifestError, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the standard input: %w", err)
+		}
+		return validation.ValidateManifest("<stdin>", data, opts)
+	}
+
+	manifestErrs := []validation.ManifestError{}
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		// The files given explicitly are validated whatever their extension.
+		if file != path {
+			switch filepath.Ext(file) {
+			case ".yaml", ".yml", ".json":
+			default:
+				return nil
+			}
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		fileErrs, err := validation.ValidateManifest(file, data, opts)
+		if err != nil {
+			return err
+		}
+		manifestErrs = append(manifestErrs, fileErrs...)
+
+		return nil
+	})
+
+	return manifestErrs, err
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/LionelJouin/network-dra/pkg/webhook"
+	"github.com/spf13/cobra"
+)
+
+type webhookOptions struct {
+	Address        string
+	TLSCertFile    string
+	TLSPrivateKey  string
+	DRADriverName  string
+	ValidationPath string
+}
+
+func newCmdWebhook() *cobra.Command {
+	webhookOpts := &webhookOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Run the validating admission webhook",
+		Long:  `Run the validating admission webhook rejecting the ResourceClaims and ResourceClaimTemplates with an invalid config for the driver`,
+		Run: func(cmd *cobra.Command, args []string) {
+			webhookOpts.run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&webhookOpts.Address,
+		"address",
+		":8443",
+		"Address the webhook server listens on.",
+	)
+
+	cmd.Flags().StringVar(
+		&webhookOpts.TLSCertFile,
+		"tls-cert-file",
+		"/etc/webhook/certs/tls.crt",
+		"TLS certificate file of the webhook server.",
+	)
+
+	cmd.Flags().StringVar(
+		&webhookOpts.TLSPrivateKey,
+		"tls-private-key-file",
+		"/etc/webhook/certs/tls.key",
+		"TLS private key file of the webhook server.",
+	)
+
+	cmd.Flags().StringVar(
+		&webhookOpts.DRADriverName,
+		"dra-driver-name",
+		"poc.dra.networking",
+		"DRA Driver Name.",
+	)
+
+	cmd.Flags().StringVar(
+		&webhookOpts.ValidationPath,
+		"validation-path",
+		"/validate",
+		"HTTP path of the validating webhook.",
+	)
+
+	return cmd
+}
+
+func (wo *webhookOptions) run(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle(wo.ValidationPath, &webhook.Validator{
+		DriverName: wo.DRADriverName,
+	})
+
+	server := &http.Server{
+		Addr:              wo.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServeTLS(wo.TLSCertFile, wo.TLSPrivateKey)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "webhook server exited with error: %v\n", err)
+		os.Exit(1)
+	}
+}
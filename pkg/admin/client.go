@@ -0,0 +1,138 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Client calls the admin API of the daemon running on the node.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the admin API served on the Unix socket.
+func NewClient(socketPath string) *Client {
+	dialer := &net.Dialer{}
+	return &Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Attachments returns the networks attached per pod, their CNI CHECK is run
+// first if check is set.
+func (c *Client) Attachments(ctx context.Context, check bool) ([]cniv1.PodAttachment, error) {
+	query := url.Values{}
+	if check {
+		query.Set("check", "true")
+	}
+
+	attachments := []cniv1.PodAttachment{}
+	err := c.do(ctx, http.MethodGet, "/v1/attachments", query, nil, &attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// ReattachNetworks detaches and attaches again the networks of the pod.
+func (c *Client) ReattachNetworks(ctx context.Context, podUID string) error {
+	return c.do(ctx, http.MethodPost, "/v1/pods/"+url.PathEscape(podUID)+"/reattach", nil, nil, nil)
+}
+
+// DetachNetworks detaches the networks of the pod while its sandbox is
+// still running.
+func (c *Client) DetachNetworks(ctx context.Context, podUID string) error {
+	return c.do(ctx, http.MethodPost, "/v1/pods/"+url.PathEscape(podUID)+"/detach", nil, nil, nil)
+}
+
+// GC runs the CNI GC of the networks attached.
+func (c *Client) GC(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/gc", nil, nil, nil)
+}
+
+// DumpStore returns the claims per pod UID of the store of the daemon.
+func (c *Client) DumpStore(ctx context.Context) (map[types.UID][]*resourcev1beta1.ResourceClaim, error) {
+	podResources := map[types.UID][]*resourcev1beta1.ResourceClaim{}
+	err := c.do(ctx, http.MethodGet, "/v1/store", nil, nil, &podResources)
+	if err != nil {
+		return nil, err
+	}
+
+	return podResources, nil
+}
+
+// LogLevel returns the log verbosity of the daemon.
+func (c *Client) LogLevel(ctx context.Context) (int, error) {
+	logLevel := LogLevel{}
+	err := c.do(ctx, http.MethodGet, "/v1/log-level", nil, nil, &logLevel)
+	return logLevel.Verbosity, err
+}
+
+// SetLogLevel changes the log verbosity of the daemon until it restarts.
+func (c *Client) SetLogLevel(ctx context.Context, verbosity int) error {
+	return c.do(ctx, http.MethodPut, "/v1/log-level", nil, LogLevel{Verbosity: verbosity}, nil)
+}
+
+// do sends the request with the JSON encoded body (if not nil) and decodes
+// the JSON response into v (if not nil).
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, v interface{}) error {
+	// The host is ignored, the connection is always made to the socket.
+	u := url.URL{
+		Scheme:   "http",
+		Host:     "network-nri-plugin",
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call the admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("admin API %s %s failed (%s): %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
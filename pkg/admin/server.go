@@ -0,0 +1,211 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// DefaultSocketPath is the path of the Unix socket the admin API is served
+// on by default.
+const DefaultSocketPath = "/var/run/network-nri-plugin/admin.sock"
+
+// maxVerbosity is the highest log verbosity looked for when reporting the
+// current one.
+const maxVerbosity = 10
+
+// Store is the store of the claims prepared per pod.
+type Store interface {
+	Dump() map[types.UID][]*resourcev1beta1.ResourceClaim
+}
+
+// LogLevel is the log verbosity of the daemon.
+type LogLevel struct {
+	Verbosity int `json:"verbosity"`
+}
+
+// Server serves the admin API of the running daemon.
+type Server struct {
+	CNI   *cniv1.CNI
+	Store Store
+	// InFlight runs the operations modifying the networks (re-attach,
+	// detach and GC), so the daemon waits for them when it stops and
+	// rejects them once stopping. They are run directly if nil.
+	InFlight func(operation func() error) error
+}
+
+// Handler returns the handler of the admin API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/attachments", s.listAttachments)
+	mux.HandleFunc("POST /v1/pods/{uid}/reattach", s.reattach)
+	mux.HandleFunc("POST /v1/pods/{uid}/detach", s.detach)
+	mux.HandleFunc("POST /v1/gc", s.gc)
+	mux.HandleFunc("GET /v1/store", s.dumpStore)
+	mux.HandleFunc("GET /v1/log-level", s.getLogLevel)
+	mux.HandleFunc("PUT /v1/log-level", s.setLogLevel)
+	return mux
+}
+
+// listAttachments returns the networks attached per pod, their CNI CHECK is
+// run first if the check query parameter is set.
+func (s *Server) listAttachments(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("check") == "true" {
+		for _, pod := range s.CNI.Attachments() {
+			// The failures are reported in the last check status.
+			_ = s.CNI.CheckNetworks(r.Context(), pod.UID)
+		}
+	}
+
+	writeJSON(r.Context(), w, s.CNI.Attachments())
+}
+
+// reattach detaches and attaches again the networks of the pod.
+func (s *Server) reattach(w http.ResponseWriter, r *http.Request) {
+	podUID := r.PathValue("uid")
+	klog.FromContext(r.Context()).Info("admin: re-attach networks", "podUID", podUID)
+	writeResult(w, s.inFlight(func() error {
+		return s.CNI.ReattachNetworks(r.Context(), podUID)
+	}))
+}
+
+// detach detaches the networks of the pod.
+func (s *Server) detach(w http.ResponseWriter, r *http.Request) {
+	podUID := r.PathValue("uid")
+	klog.FromContext(r.Context()).Info("admin: detach networks", "podUID", podUID)
+	writeResult(w, s.inFlight(func() error {
+		return s.CNI.ForceDetachNetworks(r.Context(), podUID)
+	}))
+}
+
+// gc runs the CNI GC of the networks attached.
+func (s *Server) gc(w http.ResponseWriter, r *http.Request) {
+	klog.FromContext(r.Context()).Info("admin: garbage collect networks")
+	writeResult(w, s.inFlight(func() error {
+		return s.CNI.GC(r.Context())
+	}))
+}
+
+func (s *Server) inFlight(operation func() error) error {
+	if s.InFlight == nil {
+		return operation()
+	}
+	return s.InFlight(operation)
+}
+
+// dumpStore returns the claims per pod UID of the store.
+func (s *Server) dumpStore(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, s.Store.Dump())
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	verbosity := 0
+	for verbosity < maxVerbosity && klog.V(klog.Level(verbosity+1)).Enabled() {
+		verbosity++
+	}
+
+	writeJSON(r.Context(), w, LogLevel{
+		Verbosity: verbosity,
+	})
+}
+
+// setLogLevel changes the log verbosity (-v) of the daemon until it
+// restarts.
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	logLevel := LogLevel{}
+	if err := json.NewDecoder(r.Body).Decode(&logLevel); err != nil {
+		http.Error(w, fmt.Sprintf("invalid log level: %v", err), http.StatusBadRequest)
+		return
+	}
+	if logLevel.Verbosity < 0 || logLevel.Verbosity > maxVerbosity {
+		http.Error(w, fmt.Sprintf("invalid log verbosity %d (from 0 to %d)", logLevel.Verbosity, maxVerbosity), http.StatusBadRequest)
+		return
+	}
+
+	var level klog.Level
+	if err := level.Set(strconv.Itoa(logLevel.Verbosity)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	klog.FromContext(r.Context()).Info("admin: log verbosity changed", "verbosity", logLevel.Verbosity)
+	writeJSON(r.Context(), w, logLevel)
+}
+
+// writeResult writes the error (if any) with a status code matching its
+// cause.
+func writeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, cniv1.ErrNoAttachment):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.FromContext(ctx).Error(err, "failed to write the admin API response")
+	}
+}
+
+// ListenAndServe serves the handler on the Unix socket until the context is
+// done. The socket is only accessible by its owner (root), the filesystem
+// permissions being the access control of the API.
+func ListenAndServe(ctx context.Context, socketPath string, handler http.Handler) error {
+	err := os.MkdirAll(filepath.Dir(socketPath), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create the admin socket directory: %w", err)
+	}
+
+	// Remove the socket left by a previous instance.
+	err = os.Remove(socketPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the stale admin socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on the admin socket: %w", err)
+	}
+
+	err = os.Chmod(socketPath, 0600)
+	if err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to set the admin socket permissions: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,145 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// pathPrefix is the prefix of the path returned by FindInPath for the
+// built-in plugins, so ExecPlugin can recognize them.
+const pathPrefix = "builtin:"
+
+// Plugin is a CNI plugin implemented in Go and executed in-process.
+type Plugin interface {
+	Add(ctx context.Context, args *skel.CmdArgs) (cnitypes.Result, error)
+	Del(ctx context.Context, args *skel.CmdArgs) error
+	Check(ctx context.Context, args *skel.CmdArgs) error
+}
+
+// Available returns the built-in plugins by plugin type.
+func Available() map[string]Plugin {
+	return map[string]Plugin{
+		"loopback": &Loopback{},
+	}
+}
+
+// Exec implements invoke.Exec to execute the built-in plugins in-process,
+// the other plugins are executed by the wrapped invoke.Exec.
+type Exec struct {
+	invoke.Exec
+	plugins map[string]Plugin
+}
+
+var _ invoke.Exec = &Exec{}
+
+// NewExec returns an Exec dispatching the plugin types in plugins to their
+// built-in implementation and falling back to exec for the others.
+func NewExec(exec invoke.Exec, plugins map[string]Plugin) *Exec {
+	return &Exec{
+		Exec:    exec,
+		plugins: plugins,
+	}
+}
+
+// FindInPath returns a built-in path for the built-in plugins, otherwise
+// tries to find the CNI plugin based on given path.
+func (e *Exec) FindInPath(plugin string, paths []string) (string, error) {
+	if _, exists := e.plugins[plugin]; exists {
+		return pathPrefix + plugin, nil
+	}
+
+	return e.Exec.FindInPath(plugin, paths)
+}
+
+// ExecPlugin executes the built-in plugin in-process or the CNI plugin
+// with given environment/stdin data.
+func (e *Exec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	pluginType, isBuiltin := strings.CutPrefix(pluginPath, pathPrefix)
+	plugin, exists := e.plugins[pluginType]
+	if !isBuiltin || !exists {
+		return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+	}
+
+	args := &skel.CmdArgs{
+		ContainerID: getEnv(environ, "CNI_CONTAINERID"),
+		Netns:       getEnv(environ, "CNI_NETNS"),
+		IfName:      getEnv(environ, "CNI_IFNAME"),
+		Args:        getEnv(environ, "CNI_ARGS"),
+		Path:        getEnv(environ, "CNI_PATH"),
+		StdinData:   stdinData,
+	}
+
+	switch command := getEnv(environ, "CNI_COMMAND"); command {
+	case "ADD":
+		result, err := plugin.Add(ctx, args)
+		if err != nil {
+			return nil, pluginErr(err)
+		}
+		return encodeResult(result, stdinData)
+	case "DEL":
+		return nil, pluginErr(plugin.Del(ctx, args))
+	case "CHECK":
+		return nil, pluginErr(plugin.Check(ctx, args))
+	case "GC", "STATUS":
+		return nil, nil
+	case "VERSION":
+		return json.Marshal(version.All)
+	default:
+		return nil, &cnitypes.Error{
+			Code: cnitypes.ErrInvalidEnvironmentVariables,
+			Msg:  fmt.Sprintf("unknown CNI_COMMAND: %s", command),
+		}
+	}
+}
+
+// encodeResult returns the result in the CNI version of the network config.
+func encodeResult(result cnitypes.Result, stdinData []byte) ([]byte, error) {
+	conf := &cnitypes.NetConf{}
+	err := json.Unmarshal(stdinData, conf)
+	if err != nil {
+		return nil, pluginErr(fmt.Errorf("failed to decode network config: %w", err))
+	}
+
+	versionedResult, err := result.GetAsVersion(conf.CNIVersion)
+	if err != nil {
+		return nil, pluginErr(fmt.Errorf("failed to convert result to version %s: %w", conf.CNIVersion, err))
+	}
+
+	return json.Marshal(versionedResult)
+}
+
+// pluginErr returns err as a CNI error as it would be returned by a plugin
+// binary.
+func pluginErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var cniErr *cnitypes.Error
+	if errors.As(err, &cniErr) {
+		return cniErr
+	}
+
+	return &cnitypes.Error{
+		Code: cnitypes.ErrInternal,
+		Msg:  err.Error(),
+	}
+}
+
+// getEnv returns the value of the key in the environ list.
+func getEnv(environ []string, key string) string {
+	for _, env := range environ {
+		if value, found := strings.CutPrefix(env, key+"="); found {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	cni100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"golang.org/x/sys/unix"
+)
+
+const loopbackInterface = "lo"
+
+// Loopback is a minimal built-in implementation of the loopback CNI plugin:
+// it sets the loopback interface of the network namespace up (ADD) or down
+// (DEL).
+type Loopback struct{}
+
+// Add sets the loopback interface up and returns it in the result (or the
+// previous result when chained).
+func (l *Loopback) Add(_ context.Context, args *skel.CmdArgs) (cnitypes.Result, error) {
+	conf := &cnitypes.NetConf{}
+	err := json.Unmarshal(args.StdinData, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode network config: %w", err)
+	}
+
+	err = withNetNS(args.Netns, func() error {
+		return setLinkUp(loopbackInterface, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.RawPrevResult != nil {
+		err = version.ParsePrevResult(conf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %w", err)
+		}
+		return conf.PrevResult, nil
+	}
+
+	return &cni100.Result{
+		CNIVersion: cni100.ImplementedSpecVersion,
+		Interfaces: []*cni100.Interface{
+			{
+				Name:    loopbackInterface,
+				Mac:     "00:00:00:00:00:00",
+				Sandbox: args.Netns,
+			},
+		},
+		IPs: []*cni100.IPConfig{
+			{
+				Interface: cni100.Int(0),
+				Address: net.IPNet{
+					IP:   net.IPv4(127, 0, 0, 1),
+					Mask: net.CIDRMask(8, 32),
+				},
+			},
+		},
+	}, nil
+}
+
+// Del sets the loopback interface down, a network namespace that no longer
+// exists is not an error.
+func (l *Loopback) Del(_ context.Context, args *skel.CmdArgs) error {
+	if args.Netns == "" {
+		return nil
+	}
+
+	err := withNetNS(args.Netns, func() error {
+		return setLinkUp(loopbackInterface, false)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// Check verifies the loopback interface is up.
+func (l *Loopback) Check(_ context.Context, args *skel.CmdArgs) error {
+	return withNetNS(args.Netns, func() error {
+		up, err := isLinkUp(loopbackInterface)
+		if err != nil {
+			return err
+		}
+		if !up {
+			return fmt.Errorf("interface %s is down", loopbackInterface)
+		}
+		return nil
+	})
+}
+
+// setLinkUp sets the IFF_UP flag of the interface.
+func setLinkUp(name string, up bool) error {
+	return linkFlags(name, func(fd int, ifr *unix.Ifreq) error {
+		flags := ifr.Uint16()
+		if up {
+			flags |= unix.IFF_UP
+		} else {
+			flags &^= unix.IFF_UP
+		}
+		ifr.SetUint16(flags)
+
+		err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+		if err != nil {
+			return fmt.Errorf("failed to set flags of interface %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// isLinkUp returns whether the IFF_UP flag of the interface is set.
+func isLinkUp(name string) (bool, error) {
+	up := false
+	err := linkFlags(name, func(_ int, ifr *unix.Ifreq) error {
+		up = ifr.Uint16()&unix.IFF_UP != 0
+		return nil
+	})
+	return up, err
+}
+
+// linkFlags reads the flags of the interface and calls fn with the socket
+// and the request holding them.
+func linkFlags(name string, fn func(fd int, ifr *unix.Ifreq) error) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		return fmt.Errorf("invalid interface name %s: %w", name, err)
+	}
+
+	err = unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr)
+	if err != nil {
+		return fmt.Errorf("failed to get flags of interface %s: %w", name, err)
+	}
+
+	return fn(fd, ifr)
+}
@@ -0,0 +1,48 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// withNetNS runs fn on a thread moved into the network namespace at path.
+// The error opening the namespace is returned as is so callers can check
+// whether it exists.
+func withNetNS(path string, fn func() error) error {
+	netns, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer netns.Close()
+
+	runtime.LockOSThread()
+
+	origin, err := os.Open(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to open current network namespace: %w", err)
+	}
+	defer origin.Close()
+
+	err = unix.Setns(int(netns.Fd()), unix.CLONE_NEWNET)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to enter network namespace %s: %w", path, err)
+	}
+
+	fnErr := fn()
+
+	err = unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET)
+	if err != nil {
+		// The thread stays locked so it is terminated instead of being
+		// reused by other goroutines in the wrong namespace.
+		return fmt.Errorf("failed to restore network namespace: %w", err)
+	}
+
+	runtime.UnlockOSThread()
+
+	return fnErr
+}
@@ -0,0 +1,288 @@
+package cdi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ContainerDir is the directory the network info of the claims is
+	// mounted at in the containers, one sub-directory per claim name.
+	ContainerDir = "/var/run/network-dra/claims"
+	// NetworksFile is the name of the network info file of a claim.
+	NetworksFile = "networks.json"
+
+	// EnvPrefix is the prefix of the environment variables set in the
+	// containers.
+	EnvPrefix = "NETWORK_DRA_"
+
+	specVersion = "0.6.0"
+	deviceClass = "network"
+)
+
+// ClaimInfo describes the networks of a claim to the containers.
+type ClaimInfo struct {
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	UID       string        `json:"uid"`
+	Networks  []NetworkInfo `json:"networks"`
+	// PodInfo is the path in the containers of the network info file of
+	// the pod, holding the IPs and MAC of the networks once attached (not
+	// set if the file is not mounted).
+	PodInfo string `json:"podInfo,omitempty"`
+}
+
+// NetworkInfo describes a network of a claim. The IPs and MAC depend on
+// the pod the network is attached to, they are in the network info file of
+// the pod.
+type NetworkInfo struct {
+	Request       string `json:"request"`
+	InterfaceName string `json:"interfaceName"`
+}
+
+// spec is the subset of the CDI spec written.
+type spec struct {
+	CDIVersion string   `json:"cdiVersion"`
+	Kind       string   `json:"kind"`
+	Devices    []device `json:"devices"`
+}
+
+type device struct {
+	Name           string         `json:"name"`
+	ContainerEdits containerEdits `json:"containerEdits"`
+}
+
+type containerEdits struct {
+	Env    []string `json:"env,omitempty"`
+	Mounts []mount  `json:"mounts,omitempty"`
+}
+
+type mount struct {
+	HostPath      string   `json:"hostPath"`
+	ContainerPath string   `json:"containerPath"`
+	Type          string   `json:"type,omitempty"`
+	Options       []string `json:"options,omitempty"`
+}
+
+// Handler writes a CDI spec per prepared claim, its device mounts a
+// directory holding the network info file of the claim and sets its path
+// in an environment variable. A claim can be shared by several pods and the
+// runtime reloads the specs asynchronously, so both only hold the static
+// data of the claim and are written once when it is prepared.
+type Handler struct {
+	driverName string
+	// specDir is the directory the container runtime reads the CDI specs
+	// from.
+	specDir string
+	// infoDir is the host directory of the network info files.
+	infoDir string
+	// podInfoPath is the path in the containers of the network info file
+	// of the pod, empty if not mounted.
+	podInfoPath string
+}
+
+// NewHandler returns a Handler writing the CDI specs in specDir and the
+// network info files in infoDir, the network info files of the claims
+// refer to the one of the pod at podInfoPath in the containers.
+func NewHandler(driverName string, specDir string, infoDir string, podInfoPath string) *Handler {
+	return &Handler{
+		driverName:  driverName,
+		specDir:     specDir,
+		infoDir:     infoDir,
+		podInfoPath: podInfoPath,
+	}
+}
+
+// CreateClaimSpec writes the CDI spec of the prepared claim and returns
+// the CDI device IDs of the claim.
+func (h *Handler) CreateClaimSpec(ctx context.Context, claim *resourcev1beta1.ResourceClaim) ([]string, error) {
+	info, err := h.claimInfo(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.write(claim, info)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.FromContext(ctx).V(2).Info("CDI spec created", "claim", klog.KObj(claim), "device", h.deviceID(claim.UID))
+
+	return []string{h.deviceID(claim.UID)}, nil
+}
+
+// DeleteClaimSpec removes the CDI spec and the network info file of the
+// claim.
+func (h *Handler) DeleteClaimSpec(_ context.Context, claimUID types.UID) error {
+	err := os.Remove(h.specPath(claimUID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the CDI spec of claim %s: %w", claimUID, err)
+	}
+
+	err = os.RemoveAll(filepath.Join(h.infoDir, string(claimUID)))
+	if err != nil {
+		return fmt.Errorf("failed to remove the network info of claim %s: %w", claimUID, err)
+	}
+
+	return nil
+}
+
+func (h *Handler) kind() string {
+	return h.driverName + "/" + deviceClass
+}
+
+func (h *Handler) deviceID(claimUID types.UID) string {
+	return h.kind() + "=" + string(claimUID)
+}
+
+func (h *Handler) specPath(claimUID types.UID) string {
+	return filepath.Join(h.specDir, fmt.Sprintf("%s-%s.json", h.driverName, claimUID))
+}
+
+// claimInfo returns the network info of the claim.
+func (h *Handler) claimInfo(claim *resourcev1beta1.ResourceClaim) (*ClaimInfo, error) {
+	info := &ClaimInfo{
+		Namespace: claim.Namespace,
+		Name:      claim.Name,
+		UID:       string(claim.UID),
+		Networks:  []NetworkInfo{},
+		PodInfo:   h.podInfoPath,
+	}
+
+	if claim.Status.Allocation == nil {
+		return info, nil
+	}
+
+	for _, config := range claim.Status.Allocation.Devices.Config {
+		if config.Opaque == nil || config.Opaque.Driver != h.driverName {
+			continue
+		}
+
+		parameters, err := cniv1.ParseParameters(config.Opaque.Parameters.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameters of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+		}
+
+		network := NetworkInfo{
+			InterfaceName: parameters.InterfaceName,
+		}
+		if len(config.Requests) > 0 {
+			network.Request = config.Requests[0]
+		} else if len(claim.Status.Allocation.Devices.Results) > 0 {
+			network.Request = claim.Status.Allocation.Devices.Results[0].Request
+		}
+
+		info.Networks = append(info.Networks, network)
+	}
+
+	return info, nil
+}
+
+// write writes the network info file and then the CDI spec referencing
+// it. Both are replaced atomically, so the runtime and the containers never
+// read a partial file.
+func (h *Handler) write(claim *resourcev1beta1.ResourceClaim, info *ClaimInfo) error {
+	claimInfoDir := filepath.Join(h.infoDir, string(claim.UID))
+	err := os.MkdirAll(claimInfoDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create the network info directory of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+
+	infoData, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the network info of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+
+	err = WriteFile(filepath.Join(claimInfoDir, NetworksFile), infoData, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write the network info of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+
+	containerDir := filepath.Join(ContainerDir, claim.Name)
+	env := []string{
+		EnvPrefix + EnvName(claim.Name) + "_INFO=" + filepath.Join(containerDir, NetworksFile),
+	}
+
+	specData, err := json.MarshalIndent(spec{
+		CDIVersion: specVersion,
+		Kind:       h.kind(),
+		Devices: []device{{
+			Name: string(claim.UID),
+			ContainerEdits: containerEdits{
+				Env: env,
+				Mounts: []mount{{
+					HostPath:      claimInfoDir,
+					ContainerPath: containerDir,
+					Type:          "bind",
+					Options:       []string{"ro", "nosuid", "nodev", "bind"},
+				}},
+			},
+		}},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the CDI spec of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+
+	err = os.MkdirAll(h.specDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create the CDI spec directory: %w", err)
+	}
+
+	err = WriteFile(h.specPath(claim.UID), specData, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write the CDI spec of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+
+	return nil
+}
+
+// WriteFile replaces the file at path atomically, the data is written in a
+// temporary file of the same directory, unique to each call, renamed to
+// path.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// EnvName returns the name in upper case with the characters not allowed
+// in environment variable names replaced by "_".
+func EnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
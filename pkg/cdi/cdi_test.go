@@ -0,0 +1,154 @@
+package cdi
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testDriverName = "poc.dra.networking"
+
+func testClaim() *resourcev1beta1.ResourceClaim {
+	return &resourcev1beta1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "macvlan-eth0", UID: "claim-uid"},
+		Status: resourcev1beta1.ResourceClaimStatus{
+			Allocation: &resourcev1beta1.AllocationResult{
+				Devices: resourcev1beta1.DeviceAllocationResult{
+					Results: []resourcev1beta1.DeviceRequestAllocationResult{
+						{Request: "macvlan", Driver: testDriverName, Pool: "worker", Device: "macvlan"},
+					},
+					Config: []resourcev1beta1.DeviceAllocationConfiguration{
+						{
+							Source:   resourcev1beta1.AllocationConfigSourceClaim,
+							Requests: []string{"macvlan"},
+							DeviceConfiguration: resourcev1beta1.DeviceConfiguration{
+								Opaque: &resourcev1beta1.OpaqueDeviceConfiguration{
+									Driver: testDriverName,
+									Parameters: runtime.RawExtension{
+										Raw: []byte(`{"interface":"net1","config":{"cniVersion":"1.0.0","name":"macvlan","plugins":[{"type":"macvlan","master":"eth0"}]}}`),
+									},
+								},
+							},
+						},
+						{
+							Source: resourcev1beta1.AllocationConfigSourceClaim,
+							DeviceConfiguration: resourcev1beta1.DeviceConfiguration{
+								Opaque: &resourcev1beta1.OpaqueDeviceConfiguration{
+									Driver:     "gpu.example.com",
+									Parameters: runtime.RawExtension{Raw: []byte(`{}`)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCreateClaimSpec(t *testing.T) {
+	specDir := filepath.Join(t.TempDir(), "cdi")
+	infoDir := t.TempDir()
+	handler := NewHandler(testDriverName, specDir, infoDir, "/var/run/network-dra/networks.json")
+	claim := testClaim()
+	ctx := context.Background()
+
+	deviceIDs, err := handler.CreateClaimSpec(ctx, claim)
+	if err != nil {
+		t.Fatalf("CreateClaimSpec() error = %v", err)
+	}
+	if want := []string{"poc.dra.networking/network=claim-uid"}; !slices.Equal(deviceIDs, want) {
+		t.Errorf("CreateClaimSpec() = %v, want %v", deviceIDs, want)
+	}
+
+	specPath := filepath.Join(specDir, "poc.dra.networking-claim-uid.json")
+	specData, err := os.ReadFile(specPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := spec{}
+	err = json.Unmarshal(specData, &got)
+	if err != nil {
+		t.Fatalf("invalid CDI spec: %v", err)
+	}
+	want := spec{
+		CDIVersion: specVersion,
+		Kind:       "poc.dra.networking/network",
+		Devices: []device{{
+			Name: "claim-uid",
+			ContainerEdits: containerEdits{
+				Env: []string{"NETWORK_DRA_MACVLAN_ETH0_INFO=/var/run/network-dra/claims/macvlan-eth0/networks.json"},
+				Mounts: []mount{{
+					HostPath:      filepath.Join(infoDir, "claim-uid"),
+					ContainerPath: "/var/run/network-dra/claims/macvlan-eth0",
+					Type:          "bind",
+					Options:       []string{"ro", "nosuid", "nodev", "bind"},
+				}},
+			},
+		}},
+	}
+	wantData, _ := json.Marshal(want)
+	gotData, _ := json.Marshal(got)
+	if string(gotData) != string(wantData) {
+		t.Errorf("CDI spec = %s, want %s", gotData, wantData)
+	}
+
+	infoData, err := os.ReadFile(filepath.Join(infoDir, "claim-uid", NetworksFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInfo := `{"namespace":"default","name":"macvlan-eth0","uid":"claim-uid","networks":[{"request":"macvlan","interfaceName":"net1"}],"podInfo":"/var/run/network-dra/networks.json"}`
+	var info ClaimInfo
+	err = json.Unmarshal(infoData, &info)
+	if err != nil {
+		t.Fatalf("invalid network info: %v", err)
+	}
+	if gotInfo, _ := json.Marshal(info); string(gotInfo) != wantInfo {
+		t.Errorf("network info = %s, want %s", gotInfo, wantInfo)
+	}
+
+	// No temporary file is left behind.
+	for _, dir := range []string{specDir, filepath.Join(infoDir, "claim-uid")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("%s has %d files, want 1", dir, len(entries))
+		}
+	}
+
+	err = handler.DeleteClaimSpec(ctx, claim.UID)
+	if err != nil {
+		t.Fatalf("DeleteClaimSpec() error = %v", err)
+	}
+	for _, path := range []string{specPath, filepath.Join(infoDir, "claim-uid")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", path, err)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "macvlan", want: "MACVLAN"},
+		{name: "macvlan-eth0.v2", want: "MACVLAN_ETH0_V2"},
+		{name: "Net1", want: "NET1"},
+	}
+
+	for _, tt := range tests {
+		if got := EnvName(tt.name); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
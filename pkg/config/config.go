@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LionelJouin/network-dra/pkg/integrity"
+	"github.com/LionelJouin/network-dra/pkg/policy"
+	"github.com/LionelJouin/network-dra/pkg/status"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the configuration file supported.
+	APIVersion = "config.poc.dra.networking/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "NetworkNRIPluginConfiguration"
+)
+
+// Configuration is the configuration file of the run command. An omitted
+// field keeps the default of its flag, a flag set on the command line
+// overrides the field.
+type Configuration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// DRADriverName is the name of the DRA driver.
+	DRADriverName *string `json:"draDriverName,omitempty"`
+	// LogLevel is the log verbosity (reloaded).
+	LogLevel *int `json:"logLevel,omitempty"`
+	// CNI configures the execution of the CNI plugins.
+	CNI CNI `json:"cni,omitempty"`
+	// Policy restricts the CNI configs the claims can use.
+	Policy Policy `json:"policy,omitempty"`
+	// StatusSinks are where the status of the networks is reported
+	// (claim-status, events).
+	StatusSinks []string `json:"statusSinks,omitempty"`
+	// MetricsAddress is the address the metrics are served on ("" disables).
+	MetricsAddress *string `json:"metricsAddress,omitempty"`
+	// HealthAddress is the address the health endpoints are served on (""
+	// disables).
+	HealthAddress *string `json:"healthAddress,omitempty"`
+	// AdminSocket is the unix socket the admin API is served on (""
+	// disables).
+	AdminSocket *string `json:"adminSocket,omitempty"`
+	// ShutdownTimeout is the maximum duration waited for the in-flight NRI
+	// events to finish.
+	ShutdownTimeout *metav1.Duration `json:"shutdownTimeout,omitempty"`
+	// Tracing configures the trace exporter.
+	Tracing Tracing `json:"tracing,omitempty"`
+}
+
+// CNI configures the execution of the CNI plugins.
+type CNI struct {
+	// Path is the directory of the CNI plugins.
+	Path *string `json:"path,omitempty"`
+	// CacheDir is the CNI cache directory.
+	CacheDir *string `json:"cacheDir,omitempty"`
+	// ChrootDir is the host root the plugins are executed in.
+	ChrootDir *string `json:"chrootDir,omitempty"`
+	// ExecMode is how the plugins are executed (chroot, direct or
+	// host-mountns).
+	ExecMode *string `json:"execMode,omitempty"`
+	// Timeouts of the plugin executions (reloaded).
+	Timeouts Timeouts `json:"timeouts,omitempty"`
+	// StderrLimit is the maximum number of bytes of the plugin stderr kept
+	// in the logs and errors.
+	StderrLimit *int `json:"stderrLimit,omitempty"`
+	// BuiltinPlugins are the plugin types executed in-process.
+	BuiltinPlugins []string `json:"builtinPlugins,omitempty"`
+	// PluginVerification lists the plugin types allowed to be executed and
+	// the digests of their binary (reloaded).
+	PluginVerification *integrity.Config `json:"pluginVerification,omitempty"`
+}
+
+// Timeouts of the CNI plugin executions, 0 disables a timeout.
+type Timeouts struct {
+	Add   *metav1.Duration `json:"add,omitempty"`
+	Del   *metav1.Duration `json:"del,omitempty"`
+	Check *metav1.Duration `json:"check,omitempty"`
+	GC    *metav1.Duration `json:"gc,omitempty"`
+	// Plugins overrides the command timeouts per plugin type (e.g. "dhcp")
+	// or plugin type and command (e.g. "dhcp/DEL").
+	Plugins map[string]metav1.Duration `json:"plugins,omitempty"`
+}
+
+// Policy restricts the CNI configs the claims can use, either stored in a
+// ConfigMap or inline.
+type Policy struct {
+	// ConfigMap (namespace/name) holding the policy.
+	ConfigMap *string `json:"configMap,omitempty"`
+	// Inline is the policy itself (reloaded).
+	Inline json.RawMessage `json:"inline,omitempty"`
+}
+
+// Tracing configures the trace exporter.
+type Tracing struct {
+	Endpoint      *string  `json:"endpoint,omitempty"`
+	Insecure      *bool    `json:"insecure,omitempty"`
+	SamplingRatio *float64 `json:"samplingRatio,omitempty"`
+}
+
+// Load reads, decodes and validates the configuration file at path.
+func Load(path string) (*Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes and validates a configuration.
+func Parse(data []byte) (*Configuration, error) {
+	config := &Configuration{}
+	err := yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+
+	err = config.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (c *Configuration) validate() error {
+	var errs []error
+
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		errs = append(errs, fmt.Errorf("unsupported %s %s, expected %s %s", c.APIVersion, c.Kind, APIVersion, Kind))
+	}
+
+	if c.DRADriverName != nil && *c.DRADriverName == "" {
+		errs = append(errs, errors.New("draDriverName: must not be empty"))
+	}
+
+	if c.LogLevel != nil && (*c.LogLevel < 0 || *c.LogLevel > 10) {
+		errs = append(errs, fmt.Errorf("logLevel: %d must be from 0 to 10", *c.LogLevel))
+	}
+
+	if c.CNI.ExecMode != nil {
+		if _, err := cniv1.ParseExecMode(*c.CNI.ExecMode); err != nil {
+			errs = append(errs, fmt.Errorf("cni.execMode: %w", err))
+		}
+	}
+
+	for _, timeout := range []struct {
+		name     string
+		duration *metav1.Duration
+	}{
+		{"add", c.CNI.Timeouts.Add},
+		{"del", c.CNI.Timeouts.Del},
+		{"check", c.CNI.Timeouts.Check},
+		{"gc", c.CNI.Timeouts.GC},
+	} {
+		if timeout.duration != nil && timeout.duration.Duration < 0 {
+			errs = append(errs, fmt.Errorf("cni.timeouts.%s: must not be negative", timeout.name))
+		}
+	}
+
+	for plugin, timeout := range c.CNI.Timeouts.Plugins {
+		if timeout.Duration < 0 {
+			errs = append(errs, fmt.Errorf("cni.timeouts.plugins[%s]: must not be negative", plugin))
+		}
+	}
+
+	if c.CNI.StderrLimit != nil && *c.CNI.StderrLimit < 0 {
+		errs = append(errs, errors.New("cni.stderrLimit: must not be negative"))
+	}
+
+	if c.CNI.PluginVerification != nil {
+		if err := c.CNI.PluginVerification.Normalize(); err != nil {
+			errs = append(errs, fmt.Errorf("cni.pluginVerification: %w", err))
+		}
+	}
+
+	if c.Policy.ConfigMap != nil && *c.Policy.ConfigMap != "" {
+		if _, _, found := strings.Cut(*c.Policy.ConfigMap, "/"); !found {
+			errs = append(errs, fmt.Errorf("policy.configMap: %q expected namespace/name", *c.Policy.ConfigMap))
+		}
+		if len(c.Policy.Inline) > 0 {
+			errs = append(errs, errors.New("policy: configMap and inline are mutually exclusive"))
+		}
+	}
+
+	if _, err := c.Policy.InlinePolicy(); err != nil {
+		errs = append(errs, fmt.Errorf("policy.inline: %w", err))
+	}
+
+	if err := status.ValidateSinks(c.StatusSinks); err != nil {
+		errs = append(errs, fmt.Errorf("statusSinks: %w", err))
+	}
+
+	if c.ShutdownTimeout != nil && c.ShutdownTimeout.Duration < 0 {
+		errs = append(errs, errors.New("shutdownTimeout: must not be negative"))
+	}
+
+	if c.Tracing.SamplingRatio != nil && (*c.Tracing.SamplingRatio < 0 || *c.Tracing.SamplingRatio > 1) {
+		errs = append(errs, fmt.Errorf("tracing.samplingRatio: %v must be from 0 to 1", *c.Tracing.SamplingRatio))
+	}
+
+	return errors.Join(errs...)
+}
+
+// InlinePolicy returns the inline policy, nil if not set.
+func (p Policy) InlinePolicy() (*policy.Policy, error) {
+	if len(p.Inline) == 0 {
+		return nil, nil
+	}
+	return policy.Parse(p.Inline)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// Watch watches the configuration file at path until the context is done,
+// onChange is called with the configuration each time the content of the
+// file changes and is valid. The parent directory is watched rather than
+// the file, so the file being replaced (e.g. the atomic symlink swaps of
+// the mounted ConfigMaps) is detected too, and the content is compared to
+// ignore the events not changing it.
+func Watch(ctx context.Context, path string, onChange func(*Configuration)) error {
+	logger := klog.FromContext(ctx).WithValues("path", path)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create the configuration file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to watch the configuration file directory: %w", err)
+	}
+
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error(err, "failed to read the configuration file")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error(err, "configuration file watcher error")
+			continue
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			// e.g. removed while being replaced, the next event reads it.
+			logger.V(2).Info("failed to read the configuration file", "err", err)
+			continue
+		}
+		if bytes.Equal(data, previous) {
+			continue
+		}
+		previous = data
+
+		config, err := Parse(data)
+		if err != nil {
+			logger.Error(err, "configuration file not reloaded, the previous configuration is kept")
+			continue
+		}
+
+		logger.Info("configuration file changed")
+		onChange(config)
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func configData(logLevel int) []byte {
+	return []byte(fmt.Sprintf("apiVersion: %s\nkind: %s\nlogLevel: %d\n", APIVersion, Kind, logLevel))
+}
+
+// startWatch watches path and returns the channel of the configurations
+// changed.
+func startWatch(t *testing.T, path string) <-chan *Configuration {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	changes := make(chan *Configuration, 16)
+	go func() {
+		err := Watch(ctx, path, func(cfg *Configuration) {
+			changes <- cfg
+		})
+		if err != nil {
+			t.Errorf("Watch() error = %v", err)
+		}
+	}()
+
+	return changes
+}
+
+// waitReady writes configurations until the watcher reports one, the
+// watcher being started asynchronously.
+func waitReady(t *testing.T, write func(data []byte), changes <-chan *Configuration) {
+	t.Helper()
+	for i := 1; i <= 9; i++ {
+		write(configData(i))
+		select {
+		case <-changes:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Fatal("configuration change not detected")
+}
+
+// wantLogLevel waits for the configuration with the log level, the changes
+// still pending from waitReady are skipped.
+func wantLogLevel(t *testing.T, changes <-chan *Configuration, logLevel int) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case cfg := <-changes:
+			if cfg.LogLevel != nil && *cfg.LogLevel == logLevel {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("configuration change to logLevel %d not detected", logLevel)
+		}
+	}
+}
+
+func TestWatchRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data []byte) {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(configData(0))
+
+	changes := startWatch(t, path)
+	waitReady(t, write, changes)
+
+	// An invalid configuration is not reported, the previous one is kept.
+	write([]byte("logLevel: [\n"))
+	write(configData(10))
+	wantLogLevel(t, changes, 10)
+}
+
+// TestWatchSymlinkSwap replaces the file the way the kubelet updates a
+// mounted ConfigMap, by swapping the ..data symlink to a new directory.
+func TestWatchSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	version := 0
+	write := func(data []byte) {
+		version++
+		versionDir := fmt.Sprintf("..%d", version)
+		err := os.Mkdir(filepath.Join(dir, versionDir), 0755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, versionDir, "config.yaml"), data, 0644)
+		}
+		if err == nil {
+			err = os.Symlink(versionDir, filepath.Join(dir, "..data_tmp"))
+		}
+		if err == nil {
+			err = os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(configData(0))
+	err := os.Symlink("..data/config.yaml", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := startWatch(t, path)
+	waitReady(t, write, changes)
+
+	write(configData(10))
+	wantLogLevel(t, changes, 10)
+}
@@ -0,0 +1,332 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/nri/pkg/api"
+	"golang.org/x/sys/unix"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The attributes of the ResourceSlice devices describing what the
+// containers using the device need, with or without the driver name as
+// domain (e.g. "vfioGroup" or "poc.dra.networking/vfioGroup").
+const (
+	// VFIOGroupAttribute (int or string) is the IOMMU group of the device,
+	// /dev/vfio/vfio and /dev/vfio/<group> are added to the containers.
+	VFIOGroupAttribute = "vfioGroup"
+	// DeviceNodesAttribute (string) is a comma separated list of device
+	// nodes under /dev added to the containers (e.g. "/dev/net/tun"), they
+	// must match the allowlist of the Injector.
+	DeviceNodesAttribute = "deviceNodes"
+	// HugepageSizeAttribute (string) is the size of the hugepages used with
+	// the device (e.g. "2Mi" or "1Gi"), a hugetlbfs of that page size is
+	// mounted in /dev/hugepages-<size> in the containers.
+	HugepageSizeAttribute = "hugepageSize"
+)
+
+// DefaultAllowedDeviceNodes are the device nodes the containers can get by
+// default, the VFIO devices and the TUN/TAP clone device.
+var DefaultAllowedDeviceNodes = []string{"/dev/vfio/*", "/dev/net/tun"}
+
+const (
+	devDir            = "/dev"
+	vfioDir           = "/dev/vfio"
+	hugepagesMountDir = "/dev/hugepages"
+)
+
+// Injection is what is added to the containers of a pod for its devices.
+type Injection struct {
+	Devices []*api.LinuxDevice
+	Mounts  []*api.Mount
+}
+
+// Empty returns whether nothing is added to the containers.
+func (i *Injection) Empty() bool {
+	return len(i.Devices) == 0 && len(i.Mounts) == 0
+}
+
+// Adjust adds the devices and mounts to the container adjustment.
+func (i *Injection) Adjust(adjustment *api.ContainerAdjustment) {
+	for _, device := range i.Devices {
+		adjustment.AddDevice(device)
+	}
+	for _, mount := range i.Mounts {
+		adjustment.AddMount(mount)
+	}
+}
+
+// Injector resolves the devices and mounts needed by the containers from
+// the attributes of the devices allocated to the claims of their pod. The
+// ResourceSlices of the driver on the node are kept in a cache by Run.
+type Injector struct {
+	driverName string
+	// hostRoot is where the root of the host is accessible, the device
+	// nodes are looked up under it.
+	hostRoot string
+	// allowedDeviceNodes are the patterns (path.Match) of the device nodes
+	// which can be added to the containers, the others are rejected.
+	allowedDeviceNodes []string
+
+	store      cache.Store
+	controller cache.Controller
+}
+
+// NewInjector returns an Injector resolving the device nodes matching
+// allowedDeviceNodes under hostRoot from the ResourceSlices of the driver
+// on the node (on every node if nodeName is empty).
+func NewInjector(clientSet clientset.Interface, driverName string, nodeName string, hostRoot string, allowedDeviceNodes []string) (*Injector, error) {
+	for _, pattern := range allowedDeviceNodes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid device node pattern %q: %w", pattern, err)
+		}
+	}
+
+	fieldSelector := fields.OneTermEqualSelector("spec.driver", driverName)
+	if nodeName != "" {
+		fieldSelector = fields.AndSelectors(fieldSelector, fields.OneTermEqualSelector("spec.nodeName", nodeName))
+	}
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector.String()
+			return clientSet.ResourceV1beta1().ResourceSlices().List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector.String()
+			return clientSet.ResourceV1beta1().ResourceSlices().Watch(context.TODO(), options)
+		},
+	}
+
+	store, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: listWatch,
+		ObjectType:    &resourcev1beta1.ResourceSlice{},
+		Handler:       cache.ResourceEventHandlerFuncs{},
+	})
+
+	return &Injector{
+		driverName:         driverName,
+		hostRoot:           hostRoot,
+		allowedDeviceNodes: allowedDeviceNodes,
+		store:              store,
+		controller:         controller,
+	}, nil
+}
+
+// Run keeps the cache of the ResourceSlices in sync until the context is
+// done.
+func (i *Injector) Run(ctx context.Context) {
+	i.controller.Run(ctx.Done())
+}
+
+// PodInjection returns what is added to the containers of the pod for the
+// devices allocated by the driver to its claims.
+func (i *Injector) PodInjection(ctx context.Context, claims []*resourcev1beta1.ResourceClaim) (*Injection, error) {
+	injection := &Injection{}
+
+	for _, claim := range claims {
+		if claim.Status.Allocation == nil {
+			continue
+		}
+
+		for _, result := range claim.Status.Allocation.Devices.Results {
+			if result.Driver != i.driverName {
+				continue
+			}
+
+			if !i.controller.HasSynced() {
+				return nil, fmt.Errorf("resource slices of driver %s not synced yet", i.driverName)
+			}
+
+			device := findDevice(i.resourceSlices(), result.Pool, result.Device)
+			if device == nil || device.Basic == nil {
+				continue
+			}
+
+			err := i.Resolve(injection, device.Basic.Attributes)
+			if err != nil {
+				return nil, fmt.Errorf("device %s/%s of claim %s/%s: %w", result.Pool, result.Device, claim.Namespace, claim.Name, err)
+			}
+		}
+	}
+
+	return injection, nil
+}
+
+// resourceSlices returns the ResourceSlices in the cache.
+func (i *Injector) resourceSlices() []*resourcev1beta1.ResourceSlice {
+	var resourceSlices []*resourcev1beta1.ResourceSlice
+	for _, obj := range i.store.List() {
+		if slice, ok := obj.(*resourcev1beta1.ResourceSlice); ok {
+			resourceSlices = append(resourceSlices, slice)
+		}
+	}
+	return resourceSlices
+}
+
+// findDevice returns the device of the pool from the slices of the latest
+// generation of the pool, nil if not found. The slices of the older
+// generations are being replaced, their devices are ignored.
+func findDevice(resourceSlices []*resourcev1beta1.ResourceSlice, pool string, name string) *resourcev1beta1.Device {
+	generation := int64(-1)
+	for _, slice := range resourceSlices {
+		if slice.Spec.Pool.Name == pool && slice.Spec.Pool.Generation > generation {
+			generation = slice.Spec.Pool.Generation
+		}
+	}
+
+	for _, slice := range resourceSlices {
+		if slice.Spec.Pool.Name != pool || slice.Spec.Pool.Generation != generation {
+			continue
+		}
+		for j := range slice.Spec.Devices {
+			if slice.Spec.Devices[j].Name == name {
+				return &slice.Spec.Devices[j]
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve adds to the injection the devices and mounts described by the
+// attributes of a device. The devices already in the injection are not
+// added again.
+func (i *Injector) Resolve(injection *Injection, attributes map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute) error {
+	var paths []string
+
+	if group, exists := i.attribute(attributes, VFIOGroupAttribute); exists {
+		value := attributeString(group)
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("invalid %s attribute %q", VFIOGroupAttribute, value)
+		}
+		paths = append(paths, filepath.Join(vfioDir, "vfio"), filepath.Join(vfioDir, value))
+	}
+
+	if deviceNodes, exists := i.attribute(attributes, DeviceNodesAttribute); exists {
+		for _, path := range strings.Split(attributeString(deviceNodes), ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		if slices.ContainsFunc(injection.Devices, func(device *api.LinuxDevice) bool { return device.Path == path }) {
+			continue
+		}
+		device, err := i.linuxDevice(path)
+		if err != nil {
+			return err
+		}
+		injection.Devices = append(injection.Devices, device)
+	}
+
+	if hugepageSize, exists := i.attribute(attributes, HugepageSizeAttribute); exists {
+		mount, err := hugepagesMount(attributeString(hugepageSize))
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(injection.Mounts, func(m *api.Mount) bool { return m.Destination == mount.Destination }) {
+			injection.Mounts = append(injection.Mounts, mount)
+		}
+	}
+
+	return nil
+}
+
+// attribute returns the attribute with or without the driver name as
+// domain.
+func (i *Injector) attribute(attributes map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute, name string) (resourcev1beta1.DeviceAttribute, bool) {
+	if attribute, exists := attributes[resourcev1beta1.QualifiedName(i.driverName+"/"+name)]; exists {
+		return attribute, true
+	}
+	attribute, exists := attributes[resourcev1beta1.QualifiedName(name)]
+	return attribute, exists
+}
+
+func attributeString(attribute resourcev1beta1.DeviceAttribute) string {
+	switch {
+	case attribute.StringValue != nil:
+		return *attribute.StringValue
+	case attribute.IntValue != nil:
+		return strconv.FormatInt(*attribute.IntValue, 10)
+	case attribute.VersionValue != nil:
+		return *attribute.VersionValue
+	case attribute.BoolValue != nil:
+		return strconv.FormatBool(*attribute.BoolValue)
+	}
+	return ""
+}
+
+// linuxDevice returns the device node at path (in the containers and on
+// the host) from the device node under the host root.
+func (i *Injector) linuxDevice(path string) (*api.LinuxDevice, error) {
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, devDir+"/") {
+		return nil, fmt.Errorf("device node %q not under %s", path, devDir)
+	}
+	if !slices.ContainsFunc(i.allowedDeviceNodes, func(pattern string) bool {
+		matched, _ := filepath.Match(pattern, path)
+		return matched
+	}) {
+		return nil, fmt.Errorf("device node %s is not allowed", path)
+	}
+
+	info, err := os.Stat(filepath.Join(i.hostRoot, path))
+	if err != nil {
+		return nil, fmt.Errorf("device node %s: %w", path, err)
+	}
+
+	var deviceType string
+	switch {
+	case info.Mode()&os.ModeCharDevice != 0:
+		deviceType = "c"
+	case info.Mode()&os.ModeDevice != 0:
+		deviceType = "b"
+	default:
+		return nil, fmt.Errorf("%s is not a device node", path)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, fmt.Errorf("device node %s: unsupported file info", path)
+	}
+
+	return &api.LinuxDevice{
+		Path:     path,
+		Type:     deviceType,
+		Major:    int64(unix.Major(uint64(stat.Rdev))),
+		Minor:    int64(unix.Minor(uint64(stat.Rdev))),
+		FileMode: api.FileMode(info.Mode().Perm()),
+		Uid:      api.UInt32(stat.Uid),
+		Gid:      api.UInt32(stat.Gid),
+	}, nil
+}
+
+// hugepagesMount returns the hugetlbfs mount of the page size.
+func hugepagesMount(size string) (*api.Mount, error) {
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil || quantity.Value() <= 0 {
+		return nil, fmt.Errorf("invalid %s attribute %q", HugepageSizeAttribute, size)
+	}
+
+	return &api.Mount{
+		Source:      "nodev",
+		Destination: hugepagesMountDir + "-" + quantity.String(),
+		Type:        "hugetlbfs",
+		Options:     []string{"rw", "nosuid", "nodev", "pagesize=" + strconv.FormatInt(quantity.Value(), 10)},
+	}, nil
+}
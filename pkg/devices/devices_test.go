@@ -0,0 +1,291 @@
+package devices
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+const testDriverName = "poc.dra.networking"
+
+func stringAttribute(value string) resourcev1beta1.DeviceAttribute {
+	return resourcev1beta1.DeviceAttribute{StringValue: ptr.To(value)}
+}
+
+func TestResolve(t *testing.T) {
+	hostRoot := t.TempDir()
+	err := os.MkdirAll(filepath.Join(hostRoot, "dev", "net"), 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(hostRoot, "dev", "net", "tun"), nil, 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hostRoot string
+		// attributes are the string attributes of the device.
+		attributes  map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute
+		wantDevices []string
+		wantMounts  []string
+		wantErr     string
+	}{
+		{
+			name:     "device node",
+			hostRoot: "/",
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				DeviceNodesAttribute: stringAttribute("/dev/null"),
+			},
+			wantDevices: []string{"/dev/null"},
+		},
+		{
+			name:     "attribute with the driver domain",
+			hostRoot: "/",
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				testDriverName + "/" + DeviceNodesAttribute: stringAttribute(" /dev/null, "),
+				HugepageSizeAttribute:                       stringAttribute("2Mi"),
+			},
+			wantDevices: []string{"/dev/null"},
+			wantMounts:  []string{"/dev/hugepages-2Mi"},
+		},
+		{
+			name:     "not a device node",
+			hostRoot: hostRoot,
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				DeviceNodesAttribute: stringAttribute("/dev/net/tun"),
+			},
+			wantErr: "/dev/net/tun is not a device node",
+		},
+		{
+			name:     "device node missing",
+			hostRoot: hostRoot,
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				VFIOGroupAttribute: {IntValue: ptr.To(int64(42))},
+			},
+			wantErr: "device node /dev/vfio/vfio",
+		},
+		{
+			name:     "device node not allowed",
+			hostRoot: "/",
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				DeviceNodesAttribute: stringAttribute("/dev/zero"),
+			},
+			wantErr: "device node /dev/zero is not allowed",
+		},
+		{
+			name:     "device node not under /dev",
+			hostRoot: "/",
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				DeviceNodesAttribute: stringAttribute("/dev/../etc/shadow"),
+			},
+			wantErr: `device node "/etc/shadow" not under /dev`,
+		},
+		{
+			name:     "invalid VFIO group",
+			hostRoot: "/",
+			attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+				VFIOGroupAttribute: stringAttribute("../null"),
+			},
+			wantErr: `invalid vfioGroup attribute "../null"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector, err := NewInjector(fake.NewSimpleClientset(), testDriverName, "", tt.hostRoot, append([]string{"/dev/null"}, DefaultAllowedDeviceNodes...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			injection := &Injection{}
+			err = injector.Resolve(injection, tt.attributes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			var devices []string
+			for _, device := range injection.Devices {
+				devices = append(devices, device.Path)
+				if device.Type != "c" {
+					t.Errorf("device %s type = %s, want c", device.Path, device.Type)
+				}
+			}
+			if !slices.Equal(devices, tt.wantDevices) {
+				t.Errorf("Resolve() devices = %v, want %v", devices, tt.wantDevices)
+			}
+			var mounts []string
+			for _, mount := range injection.Mounts {
+				mounts = append(mounts, mount.Destination)
+			}
+			if !slices.Equal(mounts, tt.wantMounts) {
+				t.Errorf("Resolve() mounts = %v, want %v", mounts, tt.wantMounts)
+			}
+		})
+	}
+}
+
+func TestNewInjectorInvalidPattern(t *testing.T) {
+	_, err := NewInjector(fake.NewSimpleClientset(), testDriverName, "", "/", []string{"/dev/["})
+	if err == nil {
+		t.Fatal("NewInjector() error = nil, want an invalid pattern error")
+	}
+}
+
+func TestHugepagesMount(t *testing.T) {
+	tests := []struct {
+		size            string
+		wantDestination string
+		wantPageSize    string
+		wantErr         bool
+	}{
+		{size: "2Mi", wantDestination: "/dev/hugepages-2Mi", wantPageSize: "pagesize=2097152"},
+		{size: "1Gi", wantDestination: "/dev/hugepages-1Gi", wantPageSize: "pagesize=1073741824"},
+		{size: "2097152", wantDestination: "/dev/hugepages-2097152", wantPageSize: "pagesize=2097152"},
+		{size: "0", wantErr: true},
+		{size: "-2Mi", wantErr: true},
+		{size: "large", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			mount, err := hugepagesMount(tt.size)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("hugepagesMount() = %+v, want an error", mount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("hugepagesMount() error = %v", err)
+			}
+			if mount.Type != "hugetlbfs" || mount.Destination != tt.wantDestination || !slices.Contains(mount.Options, tt.wantPageSize) {
+				t.Errorf("hugepagesMount() = %+v, want hugetlbfs in %s with %s", mount, tt.wantDestination, tt.wantPageSize)
+			}
+		})
+	}
+}
+
+func resourceSlice(name string, pool string, generation int64, devices ...string) *resourcev1beta1.ResourceSlice {
+	slice := &resourcev1beta1.ResourceSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: resourcev1beta1.ResourceSliceSpec{
+			Driver:   testDriverName,
+			NodeName: "worker",
+			Pool:     resourcev1beta1.ResourcePool{Name: pool, Generation: generation, ResourceSliceCount: 1},
+		},
+	}
+	for _, device := range devices {
+		slice.Spec.Devices = append(slice.Spec.Devices, resourcev1beta1.Device{
+			Name: device,
+			Basic: &resourcev1beta1.BasicDevice{
+				Attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{
+					"slice": stringAttribute(name),
+				},
+			},
+		})
+	}
+	return slice
+}
+
+func TestFindDevice(t *testing.T) {
+	resourceSlices := []*resourcev1beta1.ResourceSlice{
+		resourceSlice("worker-old", "worker", 1, "vf-1", "vf-2"),
+		resourceSlice("worker-new", "worker", 2, "vf-1"),
+		resourceSlice("worker-new-2", "worker", 2, "vf-3"),
+		resourceSlice("other", "other", 3, "vf-1", "vf-2"),
+	}
+
+	tests := []struct {
+		name      string
+		pool      string
+		device    string
+		wantSlice string
+	}{
+		{name: "latest generation", pool: "worker", device: "vf-1", wantSlice: "worker-new"},
+		{name: "other slice of the latest generation", pool: "worker", device: "vf-3", wantSlice: "worker-new-2"},
+		{name: "only in an older generation", pool: "worker", device: "vf-2"},
+		{name: "other pool", pool: "other", device: "vf-2", wantSlice: "other"},
+		{name: "unknown pool", pool: "unknown", device: "vf-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := findDevice(resourceSlices, tt.pool, tt.device)
+			if tt.wantSlice == "" {
+				if device != nil {
+					t.Fatalf("findDevice() = %s of slice %s, want nil", device.Name, *device.Basic.Attributes["slice"].StringValue)
+				}
+				return
+			}
+			if device == nil {
+				t.Fatalf("findDevice() = nil, want %s of slice %s", tt.device, tt.wantSlice)
+			}
+			if slice := *device.Basic.Attributes["slice"].StringValue; device.Name != tt.device || slice != tt.wantSlice {
+				t.Errorf("findDevice() = %s of slice %s, want %s of slice %s", device.Name, slice, tt.device, tt.wantSlice)
+			}
+		})
+	}
+}
+
+func TestPodInjection(t *testing.T) {
+	slice := resourceSlice("worker", "worker", 1, "tun")
+	slice.Spec.Devices[0].Basic.Attributes[DeviceNodesAttribute] = stringAttribute("/dev/null")
+	clientSet := fake.NewSimpleClientset(slice)
+
+	injector, err := NewInjector(clientSet, testDriverName, "worker", "/", []string{"/dev/null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claim := &resourcev1beta1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim"},
+		Status: resourcev1beta1.ResourceClaimStatus{
+			Allocation: &resourcev1beta1.AllocationResult{
+				Devices: resourcev1beta1.DeviceAllocationResult{
+					Results: []resourcev1beta1.DeviceRequestAllocationResult{
+						{Request: "tun", Driver: testDriverName, Pool: "worker", Device: "tun"},
+						{Request: "gpu", Driver: "gpu.example.com", Pool: "worker", Device: "gpu-0"},
+					},
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = injector.PodInjection(ctx, []*resourcev1beta1.ResourceClaim{claim})
+	if err == nil {
+		t.Fatal("PodInjection() error = nil before the resource slices are synced")
+	}
+
+	go injector.Run(ctx)
+	if !cache.WaitForCacheSync(ctx.Done(), injector.controller.HasSynced) {
+		t.Fatal("resource slices not synced")
+	}
+
+	injection, err := injector.PodInjection(ctx, []*resourcev1beta1.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("PodInjection() error = %v", err)
+	}
+	if !slices.EqualFunc(injection.Devices, []string{"/dev/null"}, func(device *api.LinuxDevice, path string) bool { return device.Path == path }) {
+		t.Errorf("PodInjection() devices = %v, want /dev/null", injection.Devices)
+	}
+}
@@ -0,0 +1,199 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check returns an error with the reason if the component is not healthy.
+type Check func(ctx context.Context) error
+
+// Checker aggregates the checks reported by the /healthz (liveness) and
+// /readyz (readiness) endpoints. The liveness checks are part of the
+// readiness too.
+type Checker struct {
+	// Timeout bounds each check, a check not returning in time (e.g. stuck
+	// on a lock) is reported as failed.
+	Timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+	info      map[string]string
+}
+
+// NewChecker returns a Checker without any check.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		Timeout:   timeout,
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+		info:      map[string]string{},
+	}
+}
+
+// AddLivenessCheck adds a check which, failing, means the process is wedged
+// and must be restarted.
+func (c *Checker) AddLivenessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness[name] = check
+}
+
+// AddReadinessCheck adds a check which, failing, means the process cannot
+// currently serve but might recover by itself (e.g. API server unreachable).
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness[name] = check
+}
+
+// SetInfo sets an information reported by both endpoints after the checks
+// (e.g. the versions of an API served).
+func (c *Checker) SetInfo(name string, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info[name] = value
+}
+
+// Handler returns the handler serving /healthz and /readyz.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, c.checks(false))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, c.checks(true))
+	})
+	return mux
+}
+
+func (c *Checker) checks(readiness bool) map[string]Check {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	checks := make(map[string]Check, len(c.liveness)+len(c.readiness))
+	for name, check := range c.liveness {
+		checks[name] = check
+	}
+	if readiness {
+		for name, check := range c.readiness {
+			checks[name] = check
+		}
+	}
+
+	return checks
+}
+
+// serve runs the checks concurrently and writes one line per check, the
+// status code is 503 if any of them failed.
+func (c *Checker) serve(w http.ResponseWriter, r *http.Request, checks map[string]Check) {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]error, len(names))
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(r.Context(), checks[name])
+		}()
+	}
+	wg.Wait()
+
+	healthy := true
+	report := strings.Builder{}
+	for i, name := range names {
+		if results[i] != nil {
+			healthy = false
+			fmt.Fprintf(&report, "[-]%s failed: %v\n", name, results[i])
+			continue
+		}
+		fmt.Fprintf(&report, "[+]%s ok\n", name)
+	}
+	report.WriteString(c.infoReport())
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		report.WriteString("check failed\n")
+	} else {
+		report.WriteString("ok\n")
+	}
+	_, _ = w.Write([]byte(report.String()))
+}
+
+// infoReport returns one line per information, sorted by name.
+func (c *Checker) infoReport() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.info))
+	for name := range c.info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(&report, "[i]%s %s\n", name, c.info[name])
+	}
+
+	return report.String()
+}
+
+// run runs the check without waiting for it more than the timeout.
+func (c *Checker) run(ctx context.Context, check Check) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check did not complete: %w", ctx.Err())
+	}
+}
+
+// ListenAndServe serves the checks on /healthz and /readyz at address until
+// the context is done.
+func ListenAndServe(ctx context.Context, address string, checker *Checker) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           checker.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,249 @@
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LionelJouin/network-dra/pkg/metrics"
+	"github.com/containernetworking/cni/pkg/invoke"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the plugin integrity verification configuration.
+type Config struct {
+	// Plugins maps the plugin types allowed to be executed to the SHA-256
+	// digests (hex encoded) their binary is allowed to have. A plugin type
+	// without digests is allowed whatever its binary is.
+	Plugins map[string][]string `json:"plugins"`
+}
+
+// LoadConfig reads and validates the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	config := &Config{}
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	err = config.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Normalize validates the digests and converts them to lowercase hex
+// without the "sha256:" prefix.
+func (c *Config) Normalize() error {
+	for pluginType, digests := range c.Plugins {
+		for i, digest := range digests {
+			digest = strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+			decoded, err := hex.DecodeString(digest)
+			if err != nil || len(decoded) != sha256.Size {
+				return fmt.Errorf("invalid SHA-256 digest %q for plugin %s", digests[i], pluginType)
+			}
+			digests[i] = digest
+		}
+	}
+
+	return nil
+}
+
+// fileDigest is the digest of a file identified by its stat, so the file is
+// hashed again only if it changed. The change time is part of it as, unlike
+// the modification time, it can't be set back after rewriting the file.
+type fileDigest struct {
+	dev        uint64
+	ino        uint64
+	size       int64
+	modTime    time.Time
+	changeTime time.Time
+	digest     string
+}
+
+// Exec implements invoke.Exec to verify the plugin binary is allowed by the
+// configuration before executing it with the wrapped invoke.Exec. The IPAM
+// and delegated plugins the plugin executes itself are not verified.
+type Exec struct {
+	invoke.Exec
+	// root is the path the filesystem the plugins are executed from is
+	// reachable at.
+	root string
+
+	mu      sync.Mutex
+	config  *Config
+	digests map[string]fileDigest
+}
+
+var _ invoke.Exec = &Exec{}
+
+// NewExec returns an Exec verifying the plugins against config, their
+// binary being read under root. The plugins are not verified while the
+// config is nil.
+func NewExec(exec invoke.Exec, config *Config, root string) *Exec {
+	return &Exec{
+		Exec:    exec,
+		config:  config,
+		root:    root,
+		digests: map[string]fileDigest{},
+	}
+}
+
+// ExecPlugin verifies the plugin binary and executes it with given
+// environment/stdin data. A binary verified against digests is executed
+// from the file it was hashed from, so it can't be replaced in between.
+func (e *Exec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	file, err := e.verify(ctx, pluginPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if file != nil {
+		defer file.Close()
+		ctx = cniv1.WithPluginFile(ctx, file)
+	}
+
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+// SetConfig replaces the configuration the plugins are verified against
+// (nil disables the verification).
+func (e *Exec) SetConfig(config *Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = config
+}
+
+// verify verifies the plugin binary, it returns the binary file opened if
+// it has been verified against digests.
+func (e *Exec) verify(ctx context.Context, pluginPath string) (*os.File, error) {
+	pluginType := filepath.Base(pluginPath)
+
+	e.mu.Lock()
+	config := e.config
+	e.mu.Unlock()
+
+	if config == nil {
+		return nil, nil
+	}
+
+	allowedDigests, allowed := config.Plugins[pluginType]
+	if !allowed {
+		return nil, e.reject(ctx, pluginType, "not-allowed", cnitypes.ErrInvalidNetworkConfig,
+			fmt.Sprintf("plugin %s is not in the allowed plugins", pluginType))
+	}
+
+	if len(allowedDigests) == 0 {
+		return nil, nil
+	}
+
+	file, err := e.open(pluginPath)
+	if err != nil {
+		return nil, e.reject(ctx, pluginType, "unreadable", cnitypes.ErrInternal,
+			fmt.Sprintf("failed to open plugin %s (%s): %v", pluginType, pluginPath, err))
+	}
+
+	digest, err := e.digest(pluginPath, file)
+	if err != nil {
+		file.Close()
+		return nil, e.reject(ctx, pluginType, "unreadable", cnitypes.ErrInternal,
+			fmt.Sprintf("failed to compute the digest of plugin %s (%s): %v", pluginType, pluginPath, err))
+	}
+
+	for _, allowedDigest := range allowedDigests {
+		if digest == allowedDigest {
+			return file, nil
+		}
+	}
+
+	file.Close()
+	return nil, e.reject(ctx, pluginType, "digest-mismatch", cnitypes.ErrInternal,
+		fmt.Sprintf("plugin %s (%s) has an unexpected SHA-256 digest %s", pluginType, pluginPath, digest))
+}
+
+// open opens the plugin binary at pluginPath in the root. The symlinks are
+// resolved within the root (an absolute symlink does not escape it) without
+// following any symlink swapped in while resolving, and the file is then
+// reopened for reading from the resolved handle.
+func (e *Exec) open(pluginPath string) (*os.File, error) {
+	handle, err := securejoin.OpenInRoot(e.root, pluginPath)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	return securejoin.Reopen(handle, unix.O_RDONLY|unix.O_CLOEXEC)
+}
+
+func (e *Exec) reject(ctx context.Context, pluginType string, reason string, code uint, msg string) error {
+	metrics.PluginRejections.WithLabelValues(pluginType, reason).Inc()
+
+	klog.FromContext(ctx).Info("CNI plugin execution rejected", "plugin", pluginType, "reason", reason, "msg", msg)
+
+	return &cnitypes.Error{
+		Code:    code,
+		Msg:     "plugin integrity verification failed",
+		Details: msg,
+	}
+}
+
+// digest returns the hex encoded SHA-256 digest of the file of the plugin
+// at pluginPath.
+func (e *Exec) digest(pluginPath string, file *os.File) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	cached := fileDigest{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		cached.dev = stat.Dev
+		cached.ino = stat.Ino
+		cached.changeTime = time.Unix(stat.Ctim.Unix())
+	}
+
+	e.mu.Lock()
+	previous, exists := e.digests[pluginPath]
+	e.mu.Unlock()
+
+	if exists && previous.dev == cached.dev && previous.ino == cached.ino && previous.size == cached.size &&
+		previous.modTime.Equal(cached.modTime) && previous.changeTime.Equal(cached.changeTime) {
+		return previous.digest, nil
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	cached.digest = hex.EncodeToString(hash.Sum(nil))
+
+	e.mu.Lock()
+	e.digests[pluginPath] = cached
+	e.mu.Unlock()
+
+	return cached.digest, nil
+}
@@ -0,0 +1,204 @@
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+)
+
+// fakeExec records the content of the file the plugin is executed from.
+type fakeExec struct {
+	invoke.Exec
+	executed []byte
+	// before is called before reading the plugin file.
+	before func()
+}
+
+func (f *fakeExec) ExecPlugin(ctx context.Context, pluginPath string, _ []byte, _ []string) ([]byte, error) {
+	if f.before != nil {
+		f.before()
+	}
+
+	f.executed = nil
+	if file := cniv1.PluginFile(ctx); file != nil {
+		data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		f.executed = data
+	}
+
+	return []byte("{}"), nil
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(data), 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func wantRejection(t *testing.T, err error) {
+	t.Helper()
+	var cniErr *cnitypes.Error
+	if !errors.As(err, &cniErr) || cniErr.Msg != "plugin integrity verification failed" {
+		t.Fatalf("ExecPlugin() error = %v, want an integrity verification failure", err)
+	}
+}
+
+func TestExecPlugin(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *Config
+		wantErr      bool
+		wantExecuted string
+	}{
+		{
+			name:   "verification disabled",
+			config: nil,
+		},
+		{
+			name:    "plugin not allowed",
+			config:  &Config{Plugins: map[string][]string{"bridge": nil}},
+			wantErr: true,
+		},
+		{
+			name:   "plugin allowed without digests",
+			config: &Config{Plugins: map[string][]string{"macvlan": nil}},
+		},
+		{
+			name:         "digest allowed",
+			config:       &Config{Plugins: map[string][]string{"macvlan": {sha256Hex("other"), sha256Hex("macvlan")}}},
+			wantExecuted: "macvlan",
+		},
+		{
+			name:    "digest not allowed",
+			config:  &Config{Plugins: map[string][]string{"macvlan": {sha256Hex("other")}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFile(t, filepath.Join(root, "opt/cni/bin/macvlan"), "macvlan")
+			inner := &fakeExec{}
+			e := NewExec(inner, tt.config, root)
+
+			_, err := e.ExecPlugin(context.Background(), "/opt/cni/bin/macvlan", nil, nil)
+			if tt.wantErr {
+				wantRejection(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExecPlugin() error = %v", err)
+			}
+			if string(inner.executed) != tt.wantExecuted {
+				t.Errorf("executed plugin file = %q, want %q", inner.executed, tt.wantExecuted)
+			}
+		})
+	}
+}
+
+func TestExecPluginCacheInvalidation(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "opt/cni/bin/macvlan")
+	writeFile(t, path, "macvlan")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewExec(&fakeExec{}, &Config{Plugins: map[string][]string{"macvlan": {sha256Hex("macvlan")}}}, root)
+
+	_, err = e.ExecPlugin(context.Background(), "/opt/cni/bin/macvlan", nil, nil)
+	if err != nil {
+		t.Fatalf("ExecPlugin() error = %v", err)
+	}
+
+	// Rewrite the binary in place with the same size and set its
+	// modification time back, only its change time differs.
+	time.Sleep(10 * time.Millisecond)
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt([]byte("MACVLAN"), 0)
+	file.Close()
+	if err == nil {
+		err = os.Chtimes(path, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.ExecPlugin(context.Background(), "/opt/cni/bin/macvlan", nil, nil)
+	wantRejection(t, err)
+}
+
+func TestExecPluginSymlinkInRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "usr/lib/cni/macvlan"), "macvlan")
+	err := os.MkdirAll(filepath.Join(root, "opt/cni/bin"), 0755)
+	if err == nil {
+		// An absolute symlink is resolved in the root.
+		err = os.Symlink("/usr/lib/cni/macvlan", filepath.Join(root, "opt/cni/bin/macvlan"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &fakeExec{}
+	e := NewExec(inner, &Config{Plugins: map[string][]string{"macvlan": {sha256Hex("macvlan")}}}, root)
+
+	_, err = e.ExecPlugin(context.Background(), "/opt/cni/bin/macvlan", nil, nil)
+	if err != nil {
+		t.Fatalf("ExecPlugin() error = %v", err)
+	}
+	if string(inner.executed) != "macvlan" {
+		t.Errorf("executed plugin file = %q, want %q", inner.executed, "macvlan")
+	}
+}
+
+func TestExecPluginReplacedAfterVerification(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "opt/cni/bin/macvlan")
+	writeFile(t, path, "macvlan")
+
+	inner := &fakeExec{
+		before: func() {
+			writeFile(t, path+".new", "malicious")
+			if err := os.Rename(path+".new", path); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	e := NewExec(inner, &Config{Plugins: map[string][]string{"macvlan": {sha256Hex("macvlan")}}}, root)
+
+	_, err := e.ExecPlugin(context.Background(), "/opt/cni/bin/macvlan", nil, nil)
+	if err != nil {
+		t.Fatalf("ExecPlugin() error = %v", err)
+	}
+	if string(inner.executed) != "macvlan" {
+		t.Errorf("executed plugin file = %q, want the verified %q", inner.executed, "macvlan")
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+)
+
+// Exec implements invoke.Exec to record the executions of the wrapped
+// invoke.Exec.
+type Exec struct {
+	invoke.Exec
+}
+
+var _ invoke.Exec = &Exec{}
+
+// NewExec returns an Exec recording the executions of exec.
+func NewExec(exec invoke.Exec) *Exec {
+	return &Exec{
+		Exec: exec,
+	}
+}
+
+// ExecPlugin executes the CNI plugin with given environment/stdin data and
+// records its result and duration.
+func (e *Exec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	pluginType := pluginType(pluginPath, stdinData)
+	command := ""
+	for _, env := range environ {
+		if value, found := strings.CutPrefix(env, "CNI_COMMAND="); found {
+			command = value
+		}
+	}
+
+	start := time.Now()
+	output, err := e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+
+	CNIExecutionDuration.WithLabelValues(pluginType, command).Observe(time.Since(start).Seconds())
+	CNIExecutions.WithLabelValues(pluginType, command, Result(err)).Inc()
+
+	return output, err
+}
+
+// pluginType returns the type of the plugin from its config, or from its
+// path if the config has no type (e.g. VERSION command).
+func pluginType(pluginPath string, stdinData []byte) string {
+	conf := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(stdinData, &conf); err == nil && conf.Type != "" {
+		return conf.Type
+	}
+	return filepath.Base(pluginPath)
+}
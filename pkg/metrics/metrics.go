@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "network_dra"
+
+const (
+	// ResultSuccess is the result label value of a successful operation.
+	ResultSuccess = "success"
+	// ResultError is the result label value of a failed operation.
+	ResultError = "error"
+	// ResultConflict is the result label value of an update failing because
+	// the object has been modified.
+	ResultConflict = "conflict"
+)
+
+// Registry is the registry of the driver metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// PluginRejections counts the CNI plugin executions rejected by the
+// integrity verification.
+var PluginRejections = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cni",
+		Name:      "plugin_rejections_total",
+		Help:      "Number of CNI plugin executions rejected by the plugin integrity verification.",
+	},
+	[]string{"plugin", "reason"},
+)
+
+// DRARequests counts the claims handled by the DRA kubelet plugin calls.
+var DRARequests = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dra",
+		Name:      "requests_total",
+		Help:      "Number of claims handled by the DRA NodePrepareResources and NodeUnprepareResources calls.",
+	},
+	[]string{"method", "result"},
+)
+
+// DRARequestDuration observes the duration of the claims handled by the DRA
+// kubelet plugin calls.
+var DRARequestDuration = factory.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "dra",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the claims handled by the DRA NodePrepareResources and NodeUnprepareResources calls.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"method"},
+)
+
+// NRIEventDuration observes the duration of the NRI events handled.
+var NRIEventDuration = factory.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "nri",
+		Name:      "event_duration_seconds",
+		Help:      "Duration of the NRI events (e.g. RunPodSandbox) handled.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	},
+	[]string{"event", "result"},
+)
+
+// CNIExecutions counts the CNI plugin executions.
+var CNIExecutions = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cni",
+		Name:      "plugin_executions_total",
+		Help:      "Number of CNI plugin executions per plugin type, command and result.",
+	},
+	[]string{"plugin", "command", "result"},
+)
+
+// CNIExecutionDuration observes the duration of the CNI plugin executions.
+var CNIExecutionDuration = factory.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "cni",
+		Name:      "plugin_execution_duration_seconds",
+		Help:      "Duration of the CNI plugin executions per plugin type and command.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	},
+	[]string{"plugin", "command"},
+)
+
+// CNIExecRetries counts the CNI plugin executions retried because the plugin
+// binary was busy ("text file busy").
+var CNIExecRetries = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cni",
+		Name:      "plugin_exec_retries_total",
+		Help:      "Number of CNI plugin executions retried because the plugin binary was busy.",
+	},
+	[]string{"plugin"},
+)
+
+// ClaimStatusUpdates counts the ResourceClaim status updates.
+var ClaimStatusUpdates = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "claim",
+		Name:      "status_updates_total",
+		Help:      "Number of ResourceClaim status updates per result (success, conflict, error).",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterStoreSize registers the gauge reporting the number of pods with
+// claims in the store.
+func RegisterStoreSize(size func() int) {
+	factory.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "store",
+			Name:      "pods",
+			Help:      "Number of pods with claims in the store.",
+		},
+		func() float64 {
+			return float64(size())
+		},
+	)
+}
+
+// Result returns the result label value of err.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
@@ -0,0 +1,214 @@
+package nri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LionelJouin/network-dra/pkg/cdi"
+	"github.com/LionelJouin/network-dra/pkg/devices"
+	"github.com/LionelJouin/network-dra/pkg/metrics"
+	"github.com/containerd/nri/pkg/api"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// PodInfoContainerPath is where the network info file of the pod is
+// mounted in the containers.
+const PodInfoContainerPath = "/var/run/network-dra/networks.json"
+
+func (p *Plugin) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	if !p.begin() {
+		return nil, nil, errPluginStopping
+	}
+	defer p.inflight.Done()
+
+	ctx, span := tracer.Start(ctx, "CreateContainer", podAttributes(pod))
+	defer span.End()
+
+	start := time.Now()
+	adjustment, err := p.createContainer(ctx, pod, container)
+	recordError(span, err)
+	metrics.NRIEventDuration.WithLabelValues("CreateContainer", metrics.Result(err)).Observe(time.Since(start).Seconds())
+	return adjustment, nil, err
+}
+
+// createContainer exposes the networks attached to the pod to the
+// container with environment variables and the network info file of the
+// pod, and adds the device nodes and mounts needed by its devices.
+func (p *Plugin) createContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, error) {
+	adjustment := &api.ContainerAdjustment{}
+
+	podAttachment, exists := p.CNI.PodAttachment(pod.Uid)
+	if exists && podAttachment.SandboxID == pod.Id {
+		err := p.adjustNetworks(ctx, adjustment, pod, container, podAttachment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := p.adjustDevices(ctx, adjustment, pod, container)
+	if err != nil {
+		return nil, err
+	}
+
+	return adjustment, nil
+}
+
+// adjustNetworks sets the environment variables of the networks attached
+// to the pod, keyed by claim and request names, and mounts the network info
+// file of the pod. The CDI specs only set the variables of the static data
+// of the claims, so each variable has a single source.
+func (p *Plugin) adjustNetworks(ctx context.Context, adjustment *api.ContainerAdjustment, pod *api.PodSandbox, container *api.Container, podAttachment cniv1.PodAttachment) error {
+	if len(podAttachment.Networks) == 0 {
+		return nil
+	}
+
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("CreateContainer", "pod.Name", pod.Name, "container.Name", container.Name, "networks", len(podAttachment.Networks))
+
+	for _, network := range podAttachment.Networks {
+		prefix := cdi.EnvPrefix + cdi.EnvName(network.Claim) + "_" + cdi.EnvName(network.Request) + "_"
+		adjustment.AddEnv(prefix+"INTERFACE", network.InterfaceName)
+		if len(network.IPs) > 0 {
+			adjustment.AddEnv(prefix+"IPS", strings.Join(network.IPs, ","))
+		}
+		if network.MAC != "" {
+			adjustment.AddEnv(prefix+"MAC", network.MAC)
+		}
+	}
+
+	if p.PodInfoDir != "" {
+		// The file is written once the networks are attached, it is written
+		// here if that failed (e.g. on Synchronize where the errors are only
+		// logged).
+		hostPath := p.podInfoPath(pod.Uid)
+		_, err := os.Stat(hostPath)
+		if os.IsNotExist(err) {
+			logger.V(2).Info("CreateContainer: writing the missing network info file", "pod.Name", pod.Name)
+			err = p.writePodAttachment(podAttachment)
+		}
+		if err != nil {
+			return fmt.Errorf("network info file of pod %s/%s not available: %w", pod.Namespace, pod.Name, err)
+		}
+
+		adjustment.AddEnv(cdi.EnvPrefix+"INFO", PodInfoContainerPath)
+		adjustment.AddMount(&api.Mount{
+			Source:      hostPath,
+			Destination: PodInfoContainerPath,
+			Type:        "bind",
+			Options:     []string{"ro", "nosuid", "nodev", "rbind"},
+		})
+	}
+
+	return nil
+}
+
+// adjustDevices adds the device nodes and mounts described by the
+// attributes of the devices allocated to the claims of the pod. They are
+// resolved once per pod sandbox.
+func (p *Plugin) adjustDevices(ctx context.Context, adjustment *api.ContainerAdjustment, pod *api.PodSandbox, container *api.Container) error {
+	if p.Devices == nil || p.Claims == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	injection, exists := p.podDevices[pod.Id]
+	p.mu.Unlock()
+
+	if !exists {
+		var err error
+		injection, err = p.Devices.PodInjection(ctx, p.Claims.Get(types.UID(pod.Uid)))
+		if err != nil {
+			return fmt.Errorf("failed to resolve the devices of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+
+		p.mu.Lock()
+		if p.podDevices == nil {
+			p.podDevices = map[string]*devices.Injection{}
+		}
+		p.podDevices[pod.Id] = injection
+		p.mu.Unlock()
+	}
+
+	if injection.Empty() {
+		return nil
+	}
+
+	klog.FromContext(ctx).V(2).Info("CreateContainer: devices", "pod.Name", pod.Name, "container.Name", container.Name, "devices", len(injection.Devices), "mounts", len(injection.Mounts))
+	injection.Adjust(adjustment)
+
+	return nil
+}
+
+// forgetPodDevices drops the devices resolved for the pod sandbox.
+func (p *Plugin) forgetPodDevices(pod *api.PodSandbox) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.podDevices, pod.Id)
+}
+
+func (p *Plugin) podInfoPath(podUID string) string {
+	return filepath.Join(p.PodInfoDir, podUID+".json")
+}
+
+// writePodInfo writes the networks attached to the pod in its network info
+// file.
+func (p *Plugin) writePodInfo(pod *api.PodSandbox) error {
+	if p.PodInfoDir == "" {
+		return nil
+	}
+
+	podAttachment, exists := p.CNI.PodAttachment(pod.Uid)
+	if !exists {
+		podAttachment = cniv1.PodAttachment{
+			UID:       pod.Uid,
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			SandboxID: pod.Id,
+			Networks:  []cniv1.NetworkAttachment{},
+		}
+	}
+
+	return p.writePodAttachment(podAttachment)
+}
+
+// writePodAttachment writes the network info file of the pod attachment.
+// The file is replaced atomically, so it is never read partially.
+func (p *Plugin) writePodAttachment(podAttachment cniv1.PodAttachment) error {
+	data, err := json.MarshalIndent(podAttachment, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the network info of pod %s/%s: %w", podAttachment.Namespace, podAttachment.Name, err)
+	}
+
+	err = os.MkdirAll(p.PodInfoDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create the network info directory: %w", err)
+	}
+
+	err = cdi.WriteFile(p.podInfoPath(podAttachment.UID), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write the network info of pod %s/%s: %w", podAttachment.Namespace, podAttachment.Name, err)
+	}
+
+	return nil
+}
+
+// removePodInfo removes the network info file of the pod.
+func (p *Plugin) removePodInfo(pod *api.PodSandbox) error {
+	if p.PodInfoDir == "" {
+		return nil
+	}
+
+	err := os.Remove(p.podInfoPath(pod.Uid))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the network info of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package nri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+)
+
+func TestAdjustNetworks(t *testing.T) {
+	pod := &api.PodSandbox{Id: "sandbox-id", Uid: "pod-uid", Name: "pod", Namespace: "default"}
+	container := &api.Container{Name: "container"}
+	podAttachment := cniv1.PodAttachment{
+		UID:       pod.Uid,
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		SandboxID: pod.Id,
+		Networks: []cniv1.NetworkAttachment{
+			{Claim: "macvlan-eth0", Request: "macvlan", InterfaceName: "net1", IPs: []string{"10.10.1.2/24", "fd00::2/64"}, MAC: "02:00:00:00:00:01"},
+			{Claim: "vlan", Request: "macvlan", InterfaceName: "net2"},
+		},
+	}
+	networkEnv := []string{
+		"NETWORK_DRA_MACVLAN_ETH0_MACVLAN_INTERFACE=net1",
+		"NETWORK_DRA_MACVLAN_ETH0_MACVLAN_IPS=10.10.1.2/24,fd00::2/64",
+		"NETWORK_DRA_MACVLAN_ETH0_MACVLAN_MAC=02:00:00:00:00:01",
+		"NETWORK_DRA_VLAN_MACVLAN_INTERFACE=net2",
+	}
+
+	tests := []struct {
+		name          string
+		podInfoDir    bool
+		podInfo       string
+		podAttachment cniv1.PodAttachment
+		wantEnv       []string
+		wantMount     bool
+		// wantPodInfo is the pod the network info file is expected for.
+		wantPodInfo string
+	}{
+		{
+			name:          "without pod info directory",
+			podAttachment: podAttachment,
+			wantEnv:       networkEnv,
+		},
+		{
+			name:          "pod info file written",
+			podInfoDir:    true,
+			podInfo:       `{"uid":"pod-uid","name":"already-written"}`,
+			podAttachment: podAttachment,
+			wantEnv:       append(slices.Clone(networkEnv), "NETWORK_DRA_INFO=/var/run/network-dra/networks.json"),
+			wantMount:     true,
+			wantPodInfo:   "already-written",
+		},
+		{
+			name:          "pod info file written on demand",
+			podInfoDir:    true,
+			podAttachment: podAttachment,
+			wantEnv:       append(slices.Clone(networkEnv), "NETWORK_DRA_INFO=/var/run/network-dra/networks.json"),
+			wantMount:     true,
+			wantPodInfo:   "pod",
+		},
+		{
+			name:          "no network",
+			podInfoDir:    true,
+			podAttachment: cniv1.PodAttachment{UID: pod.Uid, SandboxID: pod.Id},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			if tt.podInfoDir {
+				p.PodInfoDir = t.TempDir()
+			}
+			if tt.podInfo != "" {
+				err := os.WriteFile(p.podInfoPath(pod.Uid), []byte(tt.podInfo), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			adjustment := &api.ContainerAdjustment{}
+			err := p.adjustNetworks(context.Background(), adjustment, pod, container, tt.podAttachment)
+			if err != nil {
+				t.Fatalf("adjustNetworks() error = %v", err)
+			}
+
+			var env []string
+			for _, keyValue := range adjustment.Env {
+				env = append(env, keyValue.Key+"="+keyValue.Value)
+			}
+			if !slices.Equal(env, tt.wantEnv) {
+				t.Errorf("adjustNetworks() env = %v, want %v", env, tt.wantEnv)
+			}
+
+			if !tt.wantMount {
+				if len(adjustment.Mounts) != 0 {
+					t.Errorf("adjustNetworks() mounts = %v, want none", adjustment.Mounts)
+				}
+				return
+			}
+			hostPath := filepath.Join(p.PodInfoDir, pod.Uid+".json")
+			if len(adjustment.Mounts) != 1 || adjustment.Mounts[0].Source != hostPath || adjustment.Mounts[0].Destination != PodInfoContainerPath {
+				t.Fatalf("adjustNetworks() mounts = %v, want %s at %s", adjustment.Mounts, hostPath, PodInfoContainerPath)
+			}
+
+			data, err := os.ReadFile(hostPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			podInfo := cniv1.PodAttachment{}
+			err = json.Unmarshal(data, &podInfo)
+			if err != nil {
+				t.Fatalf("invalid network info file: %v", err)
+			}
+			if podInfo.Name != tt.wantPodInfo {
+				t.Errorf("network info file of pod %q, want %q", podInfo.Name, tt.wantPodInfo)
+			}
+		})
+	}
+}
+
+func TestCreateContainerStopping(t *testing.T) {
+	p := &Plugin{}
+	err := p.Stop(time.Second)
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	pod := &api.PodSandbox{Id: "sandbox-id", Uid: "pod-uid", Name: "pod", Namespace: "default"}
+	_, _, err = p.CreateContainer(context.Background(), pod, &api.Container{Name: "container"})
+	if !errors.Is(err, errPluginStopping) {
+		t.Errorf("CreateContainer() error = %v, want %v", err, errPluginStopping)
+	}
+}
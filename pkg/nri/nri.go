@@ -2,24 +2,308 @@ package nri
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/LionelJouin/network-dra/pkg/config"
+	"github.com/LionelJouin/network-dra/pkg/devices"
+	"github.com/LionelJouin/network-dra/pkg/metrics"
 	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
 	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
+
+// tracer creates the spans from the global tracer provider (no-op unless
+// tracing is enabled).
+var tracer = otel.Tracer("github.com/LionelJouin/network-dra/pkg/nri")
+
+var errPluginStopping = errors.New("network-nri-plugin is stopping")
+
+// ClaimStore is the store of the claims prepared per pod.
+type ClaimStore interface {
+	Get(podUID types.UID) []*resourcev1beta1.ResourceClaim
+	DeleteClaim(podUID types.UID, claimName string)
+}
+
+// events are the pod events handled by the plugin, the runtime does not
+// send the others.
+var events = func() api.EventMask {
+	var mask api.EventMask
+	mask.Set(api.Event_RUN_POD_SANDBOX, api.Event_STOP_POD_SANDBOX, api.Event_CREATE_CONTAINER)
+	return mask
+}()
+
 type Plugin struct {
 	Stub      stub.Stub
 	ClientSet clientset.Interface
 	CNI       *cniv1.CNI
+	// PodInfoDir is the host directory of the network info files of the
+	// pods mounted in their containers (not mounted if empty).
+	PodInfoDir string
+	// Claims and Devices add to the containers the device nodes and mounts
+	// needed by the devices allocated to the claims of their pod (none
+	// added if Devices is nil). The claims detached on StopPodSandbox are
+	// removed from Claims.
+	Claims  ClaimStore
+	Devices *devices.Injector
+	// OnConfigure is called with the configuration passed by the runtime
+	// (e.g. from /etc/nri/conf.d), nil if none, each time the plugin is
+	// configured. The configuration is rejected if it returns an error.
+	OnConfigure func(ctx context.Context, cfg *config.Configuration) error
+
+	mu sync.Mutex
+	// connected is set once the runtime configured the plugin and unset
+	// when the connection goes down.
+	connected      bool
+	disconnectedAt time.Time
+	// draining is set when the plugin is stopping, the new events are
+	// then rejected while the in-flight ones are waited for.
+	draining bool
+	inflight sync.WaitGroup
+	// podDevices are the devices resolved per pod sandbox ID.
+	podDevices map[string]*devices.Injection
+}
+
+// Run connects the plugin to the runtime and reconnects it with backoff
+// each time the connection goes down (e.g. the runtime restarted), until
+// the context is done.
+func (p *Plugin) Run(ctx context.Context, opts ...stub.Option) error {
+	logger := klog.FromContext(ctx)
+	backoff := newReconnectBackoff()
+
+	for {
+		nriStub, err := stub.New(p, append(opts, stub.WithOnClose(p.OnClose))...)
+		if err != nil {
+			return fmt.Errorf("failed to create plugin stub: %w", err)
+		}
+
+		p.mu.Lock()
+		p.Stub = nriStub
+		p.mu.Unlock()
+
+		start := time.Now()
+		err = nriStub.Run(ctx)
+		p.setConnected(false)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// The connection was up long enough to consider the runtime
+		// recovered.
+		if time.Since(start) > reconnectMaxBackoff {
+			backoff = newReconnectBackoff()
+		}
+
+		delay := backoff.Step()
+		logger.Error(err, "NRI connection lost, reconnecting", "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Stop rejects the new events, waits for the in-flight ones (CNI
+// executions and claim status updates) to finish for at most timeout and
+// then disconnects from the runtime. Run returns once the context passed to
+// it is done and Stop has been called.
+func (p *Plugin) Stop(timeout time.Duration) error {
+	p.mu.Lock()
+	p.draining = true
+	nriStub := p.Stub
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		err = fmt.Errorf("in-flight NRI events not finished after %s", timeout)
+	}
+
+	if nriStub != nil {
+		nriStub.Stop()
+	}
+
+	return err
+}
+
+// begin registers an in-flight event, it returns false if the plugin is
+// stopping.
+func (p *Plugin) begin() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.draining {
+		return false
+	}
+	p.inflight.Add(1)
+	return true
+}
+
+// InFlight runs an operation on the networks done outside of the NRI events
+// (e.g. from the admin API) as an in-flight event: it is rejected once the
+// plugin is stopping and waited for by Stop.
+func (p *Plugin) InFlight(operation func() error) error {
+	if !p.begin() {
+		return errPluginStopping
+	}
+	defer p.inflight.Done()
+
+	return operation()
+}
+
+func newReconnectBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: reconnectInitialBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      reconnectMaxBackoff,
+	}
+}
+
+// Configure is called by the runtime once the plugin is registered with
+// the plugin configuration of the runtime, which has the same schema as
+// the configuration file. The plugin subscribes to the events it handles.
+func (p *Plugin) Configure(ctx context.Context, runtimeConfig, runtime, version string) (api.EventMask, error) {
+	klog.FromContext(ctx).Info("Configure", "runtime", runtime, "version", version, "events", events.PrettyString())
+
+	var cfg *config.Configuration
+	if strings.TrimSpace(runtimeConfig) != "" {
+		var err error
+		cfg, err = config.Parse([]byte(runtimeConfig))
+		if err != nil {
+			return 0, fmt.Errorf("invalid plugin configuration from the runtime: %w", err)
+		}
+	}
+
+	if p.OnConfigure != nil {
+		err := p.OnConfigure(ctx, cfg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to apply the plugin configuration from the runtime: %w", err)
+		}
+	}
+
+	p.setConnected(true)
+	return events, nil
+}
+
+// Synchronize is called by the runtime after each (re)connection with the
+// existing pods, the networks of the pods created while the plugin was
+// disconnected get attached.
+func (p *Plugin) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+	logger := klog.FromContext(ctx)
+	logger.Info("Synchronize", "pods", len(pods))
+
+	if !p.begin() {
+		return nil, errPluginStopping
+	}
+	defer p.inflight.Done()
+
+	for _, pod := range pods {
+		podNetworkNamespace := getNetworkNamespace(pod)
+		if podNetworkNamespace == "" {
+			continue
+		}
+
+		p.addExistingClaims(ctx, pod)
+
+		err := p.CNI.SyncNetworks(ctx, pod.Id, pod.Uid, pod.Name, pod.Namespace, podNetworkNamespace)
+		if err != nil {
+			// Failing the synchronization would fail the connection, the
+			// other pods are still synchronized.
+			logger.Error(err, "failed to synchronize the networks", "pod", klog.KRef(pod.Namespace, pod.Name))
+			continue
+		}
+
+		if err := p.writePodInfo(pod); err != nil {
+			logger.Error(err, "failed to write the network info", "pod", klog.KRef(pod.Namespace, pod.Name))
+		}
+	}
+
+	return nil, nil
+}
+
+// Shutdown is called when the runtime is shutting down, the connection
+// is re-established by Run once the runtime is back.
+func (p *Plugin) Shutdown(ctx context.Context) {
+	klog.FromContext(ctx).Info("Shutdown: runtime shutting down")
+	p.setConnected(false)
+}
+
+// OnClose is called when the connection to the runtime goes down.
+func (p *Plugin) OnClose() {
+	klog.Background().Info("NRI connection closed")
+	p.setConnected(false)
+}
+
+func (p *Plugin) setConnected(connected bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connected && !connected {
+		p.disconnectedAt = time.Now()
+	}
+	p.connected = connected
+}
+
+// CheckConnection returns an error if the plugin is not connected to the
+// runtime.
+func (p *Plugin) CheckConnection(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connected {
+		return nil
+	}
+	if p.disconnectedAt.IsZero() {
+		return errors.New("not connected to the NRI runtime")
+	}
+	return fmt.Errorf("disconnected from the NRI runtime for %s", time.Since(p.disconnectedAt).Round(time.Second))
 }
 
 func (p *Plugin) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	if !p.begin() {
+		return errPluginStopping
+	}
+	defer p.inflight.Done()
+
+	ctx, span := tracer.Start(ctx, "RunPodSandbox", podAttributes(pod))
+	defer span.End()
+
+	start := time.Now()
+	err := p.runPodSandbox(ctx, pod)
+	recordError(span, err)
+	metrics.NRIEventDuration.WithLabelValues("RunPodSandbox", metrics.Result(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (p *Plugin) runPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 	klog.FromContext(ctx).Info("RunPodSandbox", "pod.Name", pod.Name)
 
 	podNetworkNamespace := getNetworkNamespace(pod)
@@ -27,29 +311,111 @@ func (p *Plugin) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 		return fmt.Errorf("error getting network namespace for pod '%s' in namespace '%s'", pod.Name, pod.Namespace)
 	}
 
-	// add existing claims
-	podObj, err := p.ClientSet.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
-	if err == nil {
-		claims := podObj.Spec.ResourceClaims
-		for _, claim := range claims {
-			if claim.ResourceClaimName != nil {
-				if claimObj, err := p.ClientSet.ResourceV1beta1().ResourceClaims(pod.Namespace).Get(ctx, *claim.ResourceClaimName, metav1.GetOptions{}); err == nil {
-					if added := p.CNI.AddNewPodResource(types.UID(pod.Uid), claimObj); added {
-						klog.FromContext(ctx).Info("RunPodSandbox add existing claim", "pod.Name", pod.Name, "claim.Name", *claim.ResourceClaimName)
-					}
-				}
-			}
+	p.addExistingClaims(ctx, pod)
+
+	err := p.CNI.AttachNetworks(ctx, pod.Id, pod.Uid, pod.Name, pod.Namespace, podNetworkNamespace)
+	if err != nil {
+		return fmt.Errorf("error CNI.AttachNetworks for pod '%s' (uid: %s) in namespace '%s': %v", pod.Name, pod.Uid, pod.Namespace, err)
+	}
+
+	// The containers are created once the sandbox is running, the file
+	// is then complete.
+	return p.writePodInfo(pod)
+}
+
+func (p *Plugin) StopPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	if !p.begin() {
+		return errPluginStopping
+	}
+	defer p.inflight.Done()
+
+	ctx, span := tracer.Start(ctx, "StopPodSandbox", podAttributes(pod))
+	defer span.End()
+
+	start := time.Now()
+	err := p.stopPodSandbox(ctx, pod)
+	recordError(span, err)
+	metrics.NRIEventDuration.WithLabelValues("StopPodSandbox", metrics.Result(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (p *Plugin) stopPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	klog.FromContext(ctx).Info("StopPodSandbox", "pod.Name", pod.Name)
+
+	// The network namespace might be gone already, the CNI plugins are
+	// still called to release their resources (e.g. IPAM).
+	podNetworkNamespace := getNetworkNamespace(pod)
+
+	p.forgetPodDevices(pod)
+
+	if err := p.removePodInfo(pod); err != nil {
+		klog.FromContext(ctx).Error(err, "failed to remove the network info", "pod", klog.KRef(pod.Namespace, pod.Name))
+	}
+
+	detachedClaims, err := p.CNI.DetachNetworks(ctx, pod.Id, pod.Uid, pod.Name, pod.Namespace, podNetworkNamespace)
+
+	// The sandbox is stopped, the claims detached are not tracked anymore
+	// (they are added again if the sandbox of the pod is recreated). The
+	// ones which failed are kept, so the runtime retrying StopPodSandbox
+	// detaches them again.
+	if p.Claims != nil {
+		for _, claimName := range detachedClaims {
+			p.Claims.DeleteClaim(types.UID(pod.Uid), claimName)
 		}
 	}
 
-	err = p.CNI.AttachNetworks(ctx, pod.Id, pod.Uid, pod.Name, pod.Namespace, podNetworkNamespace)
 	if err != nil {
-		return fmt.Errorf("error CNI.AttachNetworks for pod '%s' (uid: %s) in namespace '%s': %v", pod.Name, pod.Uid, pod.Namespace, err)
+		return fmt.Errorf("error CNI.DetachNetworks for pod '%s' (uid: %s) in namespace '%s': %v", pod.Name, pod.Uid, pod.Namespace, err)
 	}
 
 	return nil
 }
 
+// addExistingClaims adds the claims of the pod to the store, the ones
+// referenced by name and the ones generated from a template.
+func (p *Plugin) addExistingClaims(ctx context.Context, pod *api.PodSandbox) {
+	podObj, err := p.ClientSet.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+
+	claimNames := []string{}
+	for _, claim := range podObj.Spec.ResourceClaims {
+		if claim.ResourceClaimName != nil {
+			claimNames = append(claimNames, *claim.ResourceClaimName)
+		}
+	}
+	for _, status := range podObj.Status.ResourceClaimStatuses {
+		if status.ResourceClaimName != nil {
+			claimNames = append(claimNames, *status.ResourceClaimName)
+		}
+	}
+
+	for _, claimName := range claimNames {
+		if claimObj, err := p.ClientSet.ResourceV1beta1().ResourceClaims(pod.Namespace).Get(ctx, claimName, metav1.GetOptions{}); err == nil {
+			if added := p.CNI.AddNewPodResource(types.UID(pod.Uid), claimObj); added {
+				klog.FromContext(ctx).Info("add existing claim", "pod.Name", pod.Name, "claim.Name", claimName)
+			}
+		}
+	}
+}
+
+func podAttributes(pod *api.PodSandbox) trace.SpanStartOption {
+	return trace.WithAttributes(
+		semconv.K8SPodUID(pod.Uid),
+		semconv.K8SPodName(pod.Name),
+		semconv.K8SNamespaceName(pod.Namespace),
+		attribute.String("nri.pod_sandbox.id", pod.Id),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
 func getNetworkNamespace(pod *api.PodSandbox) string {
 	for _, namespace := range pod.Linux.GetNamespaces() {
 		if namespace.Type == "network" {
@@ -0,0 +1,175 @@
+package nri
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/containernetworking/cni/pkg/invoke"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"github.com/kubernetes-sigs/multi-network/pkg/store"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const testDriverName = "poc.dra.networking"
+
+// fakePlugin answers the CNI commands instead of executing the plugins,
+// the first failDel DEL commands fail.
+type fakePlugin struct {
+	mu       sync.Mutex
+	commands []string
+	failDel  int
+}
+
+func (f *fakePlugin) ExecPlugin(_ context.Context, _ string, _ []byte, environ []string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var command string
+	for _, env := range environ {
+		if value, found := strings.CutPrefix(env, "CNI_COMMAND="); found {
+			command = value
+		}
+	}
+	f.commands = append(f.commands, command)
+
+	switch command {
+	case "ADD":
+		return []byte(`{"cniVersion":"1.0.0","ips":[{"address":"10.10.1.2/24"}]}`), nil
+	case "DEL":
+		if f.failDel > 0 {
+			f.failDel--
+			return nil, &cnitypes.Error{Code: cnitypes.ErrTryAgainLater, Msg: "DEL failed"}
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakePlugin) FindInPath(plugin string, paths []string) (string, error) {
+	return filepath.Join(paths[0], plugin), nil
+}
+
+func (f *fakePlugin) Decode(jsonBytes []byte) (version.PluginInfo, error) {
+	decoder := &version.PluginDecoder{}
+	return decoder.Decode(jsonBytes)
+}
+
+func (f *fakePlugin) count(command string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, c := range f.commands {
+		if c == command {
+			count++
+		}
+	}
+	return count
+}
+
+func testClaim(name string, interfaceName string) *resourcev1beta1.ResourceClaim {
+	return &resourcev1beta1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name + "-uid")},
+		Status: resourcev1beta1.ResourceClaimStatus{
+			Allocation: &resourcev1beta1.AllocationResult{
+				Devices: resourcev1beta1.DeviceAllocationResult{
+					Results: []resourcev1beta1.DeviceRequestAllocationResult{
+						{Request: "macvlan", Driver: testDriverName, Pool: "worker", Device: "macvlan"},
+					},
+					Config: []resourcev1beta1.DeviceAllocationConfiguration{{
+						Source: resourcev1beta1.AllocationConfigSourceClaim,
+						DeviceConfiguration: resourcev1beta1.DeviceConfiguration{
+							Opaque: &resourcev1beta1.OpaqueDeviceConfiguration{
+								Driver: testDriverName,
+								Parameters: runtime.RawExtension{
+									Raw: []byte(`{"interface":"` + interfaceName + `","config":{"cniVersion":"1.0.0","name":"` + name + `","plugins":[{"type":"macvlan","master":"eth0"}]}}`),
+								},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// testPlugin returns a plugin attaching the networks with the fake plugin
+// and its claim store.
+func testPlugin(t *testing.T, plugin *fakePlugin) (*Plugin, *store.Memory) {
+	t.Helper()
+	claims := store.NewMemory()
+	return &Plugin{
+		CNI: cniv1.New(testDriverName, "/", []string{t.TempDir()}, t.TempDir(), nil, claims,
+			cniv1.WithExecWrapper(func(invoke.Exec) invoke.Exec { return plugin })),
+		Claims: claims,
+	}, claims
+}
+
+func TestStopPodSandboxRetry(t *testing.T) {
+	plugin := &fakePlugin{failDel: 1}
+	p, claims := testPlugin(t, plugin)
+	pod := &api.PodSandbox{Id: "sandbox-id", Uid: "pod-uid", Name: "pod", Namespace: "default"}
+	ctx := context.Background()
+
+	claims.Add(types.UID(pod.Uid), testClaim("net1", "net1"))
+	err := p.CNI.AttachNetworks(ctx, pod.Id, pod.Uid, pod.Name, pod.Namespace, "/var/run/netns/pod")
+	if err != nil {
+		t.Fatalf("AttachNetworks() error = %v", err)
+	}
+
+	// The DEL fails, the claim is kept for the runtime to retry.
+	err = p.stopPodSandbox(ctx, pod)
+	if err == nil {
+		t.Fatal("stopPodSandbox() error = nil, want the DEL failure")
+	}
+	if got := claims.Get(types.UID(pod.Uid)); len(got) != 1 {
+		t.Fatalf("claims of the pod after a failed DEL = %d, want 1", len(got))
+	}
+
+	err = p.stopPodSandbox(ctx, pod)
+	if err != nil {
+		t.Fatalf("stopPodSandbox() retry error = %v", err)
+	}
+	if got := plugin.count("DEL"); got != 2 {
+		t.Errorf("DEL executed %d times, want 2", got)
+	}
+	if got := claims.Get(types.UID(pod.Uid)); len(got) != 0 {
+		t.Errorf("claims of the pod after the DEL = %d, want 0", len(got))
+	}
+}
+
+func TestStopPodSandboxPartialFailure(t *testing.T) {
+	plugin := &fakePlugin{failDel: 1}
+	p, claims := testPlugin(t, plugin)
+	pod := &api.PodSandbox{Id: "sandbox-id", Uid: "pod-uid", Name: "pod", Namespace: "default"}
+	ctx := context.Background()
+
+	claims.Add(types.UID(pod.Uid), testClaim("net1", "net1"))
+	claims.Add(types.UID(pod.Uid), testClaim("net2", "net2"))
+	err := p.CNI.AttachNetworks(ctx, pod.Id, pod.Uid, pod.Name, pod.Namespace, "/var/run/netns/pod")
+	if err != nil {
+		t.Fatalf("AttachNetworks() error = %v", err)
+	}
+
+	err = p.stopPodSandbox(ctx, pod)
+	if err == nil {
+		t.Fatal("stopPodSandbox() error = nil, want the DEL failure")
+	}
+
+	// Only the claim which failed to be detached is kept.
+	var remaining []string
+	for _, claim := range claims.Get(types.UID(pod.Uid)) {
+		remaining = append(remaining, claim.Name)
+	}
+	if !slices.Equal(remaining, []string{"net1"}) {
+		t.Errorf("claims of the pod = %v, want [net1]", remaining)
+	}
+}
@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	corev1 "k8s.io/api/core/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/fields"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// ConfigMapKey is the key of the policy in the ConfigMap data.
+const ConfigMapKey = "policy.yaml"
+
+// Engine evaluates the claims against the policy stored in a ConfigMap or
+// set directly. Until the policy is loaded, or if it is invalid or deleted,
+// every claim targeting the driver is rejected.
+type Engine struct {
+	driverName string
+
+	mu     sync.RWMutex
+	policy *Policy
+	err    error
+}
+
+// NewEngine returns an engine evaluating the claims of the driver.
+func NewEngine(driverName string) *Engine {
+	return &Engine{
+		driverName: driverName,
+		err:        errors.New("policy not loaded yet"),
+	}
+}
+
+// Run keeps the policy in sync with the ConfigMap until the context is done.
+func (e *Engine) Run(ctx context.Context, clientSet clientset.Interface, namespace string, name string) {
+	listWatch := cache.NewListWatchFromClient(
+		clientSet.CoreV1().RESTClient(),
+		"configmaps",
+		namespace,
+		fields.OneTermEqualSelector("metadata.name", name),
+	)
+
+	_, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: listWatch,
+		ObjectType:    &corev1.ConfigMap{},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				e.load(ctx, obj)
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				e.load(ctx, obj)
+			},
+			DeleteFunc: func(_ interface{}) {
+				e.set(nil, fmt.Errorf("policy configmap %s/%s deleted", namespace, name))
+			},
+		},
+	})
+
+	controller.Run(ctx.Done())
+}
+
+func (e *Engine) load(ctx context.Context, obj interface{}) {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+
+	policy, err := Parse([]byte(configMap.Data[ConfigMapKey]))
+	if err != nil {
+		err = fmt.Errorf("invalid policy in configmap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+		klog.FromContext(ctx).Error(err, "failed to load policy")
+		e.set(nil, err)
+		return
+	}
+
+	klog.FromContext(ctx).Info("policy loaded", "configmap", klog.KObj(configMap), "resourceVersion", configMap.ResourceVersion)
+	e.set(policy, nil)
+}
+
+// SetPolicy replaces the policy evaluated, nil does not restrict the
+// claims. It is used instead of Run when the policy is not stored in a
+// ConfigMap.
+func (e *Engine) SetPolicy(policy *Policy) {
+	e.set(policy, nil)
+}
+
+func (e *Engine) set(policy *Policy, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = policy
+	e.err = err
+}
+
+// ValidateClaim returns an error with the reason if the CNI config of the
+// allocated claim does not comply with the policy of its namespace.
+func (e *Engine) ValidateClaim(_ context.Context, claim *resourcev1beta1.ResourceClaim) error {
+	if claim.Status.Allocation == nil {
+		return nil
+	}
+
+	e.mu.RLock()
+	policy, policyErr := e.policy, e.err
+	e.mu.RUnlock()
+
+	if policy == nil && policyErr == nil {
+		return nil
+	}
+
+	for _, config := range claim.Status.Allocation.Devices.Config {
+		if config.Opaque == nil || config.Opaque.Driver != e.driverName {
+			continue
+		}
+
+		if policyErr != nil {
+			return fmt.Errorf("network policy of claim %s/%s cannot be evaluated: %w", claim.Namespace, claim.Name, policyErr)
+		}
+
+		parameters, err := cniv1.ParseParameters(config.Opaque.Parameters.Raw)
+		if err != nil {
+			return fmt.Errorf("invalid parameters of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+		}
+
+		err = policy.Validate(claim.Namespace, parameters)
+		if err != nil {
+			return fmt.Errorf("claim %s/%s rejected by the network policy of namespace %s: %w", claim.Namespace, claim.Name, claim.Namespace, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,361 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Rules restricts what the network configuration of a claim can contain.
+// A nil list does not restrict, an empty list allows nothing.
+type Rules struct {
+	// PluginTypes are the CNI plugin types (including IPAM) allowed.
+	PluginTypes []string `json:"pluginTypes,omitempty"`
+	// Masters are the host interfaces (names or PCI addresses) the plugins
+	// are allowed to use, see hostInterfaceFields. The plugin types whose
+	// host interface fields are unknown are not allowed.
+	Masters []string `json:"masters,omitempty"`
+	// Subnets are the CIDRs the IPAM subnets and addresses must be part of.
+	Subnets []string `json:"subnets,omitempty"`
+	// InterfaceNames are the patterns (path.Match syntax, e.g. "net*") the
+	// pod interface name must match.
+	InterfaceNames []string `json:"interfaceNames,omitempty"`
+
+	subnets []*net.IPNet
+}
+
+// Policy is the set of rules applied per namespace.
+type Policy struct {
+	// Default are the rules of the namespaces not listed in Namespaces
+	// (no restriction if nil).
+	Default *Rules `json:"default,omitempty"`
+	// Namespaces are the rules per namespace.
+	Namespaces map[string]*Rules `json:"namespaces,omitempty"`
+}
+
+// Parse decodes and validates a policy.
+func Parse(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	err := yaml.UnmarshalStrict(data, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+
+	err = policy.Default.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid default rules: %w", err)
+	}
+
+	for namespace, rules := range policy.Namespaces {
+		err = rules.compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules of namespace %s: %w", namespace, err)
+		}
+	}
+
+	return policy, nil
+}
+
+// rules returns the rules applied to the namespace.
+func (p *Policy) rules(namespace string) *Rules {
+	if rules, exists := p.Namespaces[namespace]; exists {
+		return rules
+	}
+	return p.Default
+}
+
+// Validate returns an error describing every violation of the rules of the
+// namespace by the parameters.
+func (p *Policy) Validate(namespace string, parameters *cniv1.Parameters) error {
+	rules := p.rules(namespace)
+	if rules == nil {
+		return nil
+	}
+
+	violations := []string{}
+
+	if rules.InterfaceNames != nil && !matchAny(rules.InterfaceNames, parameters.InterfaceName) {
+		violations = append(violations, fmt.Sprintf("interface name %q is not allowed", parameters.InterfaceName))
+	}
+
+	confList, err := libcni.ConfListFromBytes(parameters.Config.Raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse CNI config: %w", err)
+	}
+
+	for _, plugin := range confList.Plugins {
+		violations = append(violations, rules.validatePlugin(plugin.Bytes, 0)...)
+	}
+
+	if len(violations) > 0 {
+		return errors.New(strings.Join(violations, "; "))
+	}
+
+	return nil
+}
+
+// hostInterfaceFields are the fields of the plugin config naming the host
+// interface used by the plugin type (none for the plugins not using any).
+var hostInterfaceFields = map[string][]string{
+	"macvlan":     {"master"},
+	"ipvlan":      {"master"},
+	"vlan":        {"master"},
+	"host-device": {"device", "pciBusID", "kernelpath"},
+	"sriov":       {"deviceID"},
+	"bridge":      {"bridge"},
+	"tap":         {"bridge"},
+	"ptp":         nil,
+	"dummy":       nil,
+	"loopback":    nil,
+	"tuning":      nil,
+	"portmap":     nil,
+	"bandwidth":   nil,
+	"firewall":    nil,
+	"sbr":         nil,
+	"vrf":         nil,
+	// The configs the meta plugins delegate to are checked instead.
+	"flannel": nil,
+	"multus":  nil,
+}
+
+// hostInterfaceDefault is the host interface a plugin type uses when its
+// host interface field is missing or empty.
+type hostInterfaceDefault struct {
+	field string
+	// value is the interface used, empty if it is not known from the
+	// config (e.g. the interface of the default route of the host).
+	value string
+}
+
+// hostInterfaceDefaults are the plugin types falling back to a host
+// interface when none is configured.
+var hostInterfaceDefaults = map[string]hostInterfaceDefault{
+	"macvlan": {field: "master"},
+	"ipvlan":  {field: "master"},
+	"vlan":    {field: "master"},
+	"bridge":  {field: "bridge", value: "cni0"},
+}
+
+// maxDelegateDepth limits the nesting of the delegated plugin configs.
+const maxDelegateDepth = 8
+
+// pluginConfig is the part of a plugin config the rules apply to.
+type pluginConfig struct {
+	Type string     `json:"type"`
+	IPAM ipamConfig `json:"ipam,omitempty"`
+	// Delegate and Delegates are the plugin configs (or config lists) a
+	// meta plugin (e.g. flannel or multus) executes.
+	Delegate  json.RawMessage   `json:"delegate,omitempty"`
+	Delegates []json.RawMessage `json:"delegates,omitempty"`
+}
+
+// ipamConfig holds the subnet and address fields of the commonly used IPAM
+// plugins (host-local, static, whereabouts).
+type ipamConfig struct {
+	Type   string `json:"type,omitempty"`
+	Subnet string `json:"subnet,omitempty"`
+	Range  string `json:"range,omitempty"`
+	Ranges [][]struct {
+		Subnet string `json:"subnet"`
+	} `json:"ranges,omitempty"`
+	Addresses []struct {
+		Address string `json:"address"`
+	} `json:"addresses,omitempty"`
+}
+
+// validatePlugin validates a plugin config and the configs it delegates to.
+func (r *Rules) validatePlugin(pluginBytes []byte, depth int) []string {
+	config := &pluginConfig{}
+	err := json.Unmarshal(pluginBytes, config)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse plugin config: %v", err)}
+	}
+
+	violations := []string{}
+
+	if r.PluginTypes != nil {
+		for _, pluginType := range []string{config.Type, config.IPAM.Type} {
+			if pluginType != "" && !slices.Contains(r.PluginTypes, pluginType) {
+				violations = append(violations, fmt.Sprintf("plugin type %q is not allowed", pluginType))
+			}
+		}
+	}
+
+	if r.Masters != nil {
+		violations = append(violations, r.validateHostInterfaces(config.Type, pluginBytes)...)
+	}
+
+	if r.subnets != nil {
+		for _, cidr := range config.IPAM.cidrs() {
+			if !r.allowedCIDR(cidr) {
+				violations = append(violations, fmt.Sprintf("subnet %q is not allowed", cidr))
+			}
+		}
+	}
+
+	delegates := config.Delegates
+	if len(config.Delegate) > 0 {
+		delegates = append(delegates, config.Delegate)
+	}
+	if len(delegates) > 0 && depth >= maxDelegateDepth {
+		return append(violations, fmt.Sprintf("plugin %q delegates nested too deeply", config.Type))
+	}
+	for _, delegate := range delegates {
+		violations = append(violations, r.validateDelegate(delegate, depth+1)...)
+	}
+
+	return violations
+}
+
+// validateDelegate validates a delegated plugin config or config list.
+func (r *Rules) validateDelegate(delegateBytes []byte, depth int) []string {
+	confList := &struct {
+		Plugins []json.RawMessage `json:"plugins"`
+	}{}
+	err := json.Unmarshal(delegateBytes, confList)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse delegated plugin config: %v", err)}
+	}
+
+	if confList.Plugins == nil {
+		return r.validatePlugin(delegateBytes, depth)
+	}
+
+	violations := []string{}
+	for _, plugin := range confList.Plugins {
+		violations = append(violations, r.validatePlugin(plugin, depth)...)
+	}
+	return violations
+}
+
+// validateHostInterfaces validates the host interfaces used by the plugin.
+func (r *Rules) validateHostInterfaces(pluginType string, pluginBytes []byte) []string {
+	fields, known := hostInterfaceFields[pluginType]
+	if !known {
+		return []string{fmt.Sprintf("plugin type %q is not allowed with masters restricted, its host interface is unknown", pluginType)}
+	}
+
+	values := map[string]any{}
+	err := json.Unmarshal(pluginBytes, &values)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse plugin config: %v", err)}
+	}
+
+	violations := []string{}
+	masters := map[string]string{}
+	for _, field := range fields {
+		value, exists := values[field]
+		if !exists {
+			continue
+		}
+		master, ok := value.(string)
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s of plugin %q is not a string", field, pluginType))
+			continue
+		}
+		if master != "" {
+			masters[field] = master
+		}
+	}
+
+	// A missing host interface does not bypass the restriction, the
+	// plugin uses its default one.
+	if hostDefault, exists := hostInterfaceDefaults[pluginType]; exists && masters[hostDefault.field] == "" {
+		if hostDefault.value == "" {
+			violations = append(violations, fmt.Sprintf("%s of plugin %q is required with masters restricted", hostDefault.field, pluginType))
+		} else {
+			masters[hostDefault.field] = hostDefault.value
+		}
+	}
+
+	for _, field := range fields {
+		if master, exists := masters[field]; exists && !slices.Contains(r.Masters, master) {
+			violations = append(violations, fmt.Sprintf("%s %q is not allowed", field, master))
+		}
+	}
+
+	return violations
+}
+
+// cidrs returns the subnets and addresses configured in the IPAM.
+func (ipam ipamConfig) cidrs() []string {
+	cidrs := []string{}
+	for _, cidr := range []string{ipam.Subnet, ipam.Range} {
+		if cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	for _, rangeSet := range ipam.Ranges {
+		for _, r := range rangeSet {
+			cidrs = append(cidrs, r.Subnet)
+		}
+	}
+	for _, address := range ipam.Addresses {
+		cidrs = append(cidrs, address.Address)
+	}
+	return cidrs
+}
+
+// allowedCIDR returns whether the CIDR is fully contained in an allowed
+// subnet.
+func (r *Rules) allowedCIDR(cidr string) bool {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	ones, _ := ipNet.Mask.Size()
+
+	for _, subnet := range r.subnets {
+		subnetOnes, subnetBits := subnet.Mask.Size()
+		if subnet.Contains(ip) && subnetOnes <= ones && subnetBits == len(ipNet.Mask)*8 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Rules) compile() error {
+	if r == nil {
+		return nil
+	}
+
+	for _, pattern := range r.InterfaceNames {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid interface name pattern %q: %w", pattern, err)
+		}
+	}
+
+	if r.Subnets == nil {
+		return nil
+	}
+
+	r.subnets = []*net.IPNet{}
+	for _, subnet := range r.Subnets {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return fmt.Errorf("invalid subnet %q: %w", subnet, err)
+		}
+		r.subnets = append(r.subnets, ipNet)
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
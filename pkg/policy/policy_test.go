@@ -0,0 +1,226 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testPolicy = `
+default:
+  pluginTypes: [macvlan, host-device, sriov, bridge, custom, host-local, static]
+  masters: [eth0, "0000:3b:00.1", br0]
+  subnets: [10.10.0.0/16]
+  interfaceNames: ["net*"]
+namespaces:
+  open: {}
+  no-plugins:
+    pluginTypes: []
+`
+
+func parameters(interfaceName string, config string) *cniv1.Parameters {
+	return &cniv1.Parameters{
+		InterfaceName: interfaceName,
+		Config:        runtime.RawExtension{Raw: []byte(`{"cniVersion":"1.0.0","name":"net","plugins":[` + config + `]}`)},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		interfaceName string
+		config        string
+		// wantErr are the violations expected in the error, none if empty.
+		wantErr []string
+	}{
+		{
+			name:          "compliant",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":"eth0","ipam":{"type":"host-local","subnet":"10.10.1.0/24"}}`,
+		},
+		{
+			name:          "interface name not allowed",
+			interfaceName: "eth1",
+			config:        `{"type":"macvlan","master":"eth0"}`,
+			wantErr:       []string{`interface name "eth1" is not allowed`},
+		},
+		{
+			name:          "plugin and IPAM types not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"ipvlan","master":"eth0","ipam":{"type":"dhcp"}}`,
+			wantErr:       []string{`plugin type "ipvlan" is not allowed`, `plugin type "dhcp" is not allowed`},
+		},
+		{
+			name:          "macvlan master not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":"eth1"}`,
+			wantErr:       []string{`master "eth1" is not allowed`},
+		},
+		{
+			name:          "host-device device not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"host-device","device":"eth1"}`,
+			wantErr:       []string{`device "eth1" is not allowed`},
+		},
+		{
+			name:          "host-device PCI address allowed",
+			interfaceName: "net1",
+			config:        `{"type":"host-device","pciBusID":"0000:3b:00.1"}`,
+		},
+		{
+			name:          "host-device PCI address not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"host-device","pciBusID":"0000:3b:00.2"}`,
+			wantErr:       []string{`pciBusID "0000:3b:00.2" is not allowed`},
+		},
+		{
+			name:          "host-device kernel path not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"host-device","kernelpath":"/sys/devices/pci0000:00/0000:00:02.0/net/eth1"}`,
+			wantErr:       []string{`kernelpath "/sys/devices/pci0000:00/0000:00:02.0/net/eth1" is not allowed`},
+		},
+		{
+			name:          "sriov device ID not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"sriov","deviceID":"0000:3b:02.0"}`,
+			wantErr:       []string{`deviceID "0000:3b:02.0" is not allowed`},
+		},
+		{
+			name:          "bridge not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"bridge","bridge":"cni0"}`,
+			wantErr:       []string{`bridge "cni0" is not allowed`},
+		},
+		{
+			name:          "macvlan master missing",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan"}`,
+			wantErr:       []string{`master of plugin "macvlan" is required with masters restricted`},
+		},
+		{
+			name:          "ipvlan master empty",
+			interfaceName: "net1",
+			config:        `{"type":"ipvlan","master":""}`,
+			wantErr:       []string{`master of plugin "ipvlan" is required with masters restricted`},
+		},
+		{
+			name:          "bridge default not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"bridge"}`,
+			wantErr:       []string{`bridge "cni0" is not allowed`},
+		},
+		{
+			name:          "host interface field not a string",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":["eth1"]}`,
+			wantErr:       []string{`master of plugin "macvlan" is not a string`},
+		},
+		{
+			name:          "unknown host interface",
+			interfaceName: "net1",
+			config:        `{"type":"custom","master":"eth0"}`,
+			wantErr:       []string{`plugin type "custom" is not allowed with masters restricted`},
+		},
+		{
+			name:          "subnet not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":"eth0","ipam":{"type":"host-local","ranges":[[{"subnet":"10.20.0.0/24"}]]}}`,
+			wantErr:       []string{`subnet "10.20.0.0/24" is not allowed`},
+		},
+		{
+			name:          "subnet larger than allowed",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":"eth0","ipam":{"type":"host-local","subnet":"10.0.0.0/8"}}`,
+			wantErr:       []string{`subnet "10.0.0.0/8" is not allowed`},
+		},
+		{
+			name:          "static address not allowed",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":"eth0","ipam":{"type":"static","addresses":[{"address":"192.168.1.1/24"}]}}`,
+			wantErr:       []string{`subnet "192.168.1.1/24" is not allowed`},
+		},
+		{
+			name:          "namespace without restriction",
+			namespace:     "open",
+			interfaceName: "eth1",
+			config:        `{"type":"ipvlan","master":"eth1"}`,
+		},
+		{
+			name:          "empty list allows nothing",
+			namespace:     "no-plugins",
+			interfaceName: "net1",
+			config:        `{"type":"macvlan","master":"eth0"}`,
+			wantErr:       []string{`plugin type "macvlan" is not allowed`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.namespace, parameters(tt.interfaceName, tt.config))
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDelegates(t *testing.T) {
+	policy, err := Parse([]byte(`
+default:
+  pluginTypes: [flannel, multus, macvlan, bridge]
+  masters: [eth0, cni0]
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "delegate",
+			config:  `{"type":"flannel","delegate":{"type":"macvlan","master":"eth1"}}`,
+			wantErr: `master "eth1" is not allowed`,
+		},
+		{
+			name:    "delegated config list",
+			config:  `{"type":"multus","delegates":[{"name":"a","plugins":[{"type":"ipvlan","master":"eth0"}]}]}`,
+			wantErr: `plugin type "ipvlan" is not allowed`,
+		},
+		{
+			name:    "nested delegates",
+			config:  `{"type":"multus","delegates":[{"type":"multus","delegates":[{"type":"bridge","bridge":"br1"}]}]}`,
+			wantErr: `bridge "br1" is not allowed`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate("default", parameters("net1", tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
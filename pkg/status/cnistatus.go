@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/LionelJouin/network-dra/pkg/metrics"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
 	cni100 "github.com/containernetworking/cni/pkg/types/100"
 	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientset "k8s.io/client-go/kubernetes"
@@ -79,8 +81,14 @@ func (cnish *CNIStatusHandler) UpdateStatus(ctx context.Context, claim *resource
 
 	_, err = cnish.ClientSet.ResourceV1beta1().ResourceClaims(claim.GetNamespace()).UpdateStatus(ctx, claim, v1.UpdateOptions{})
 	if err != nil {
+		if apierrors.IsConflict(err) {
+			metrics.ClaimStatusUpdates.WithLabelValues(metrics.ResultConflict).Inc()
+		} else {
+			metrics.ClaimStatusUpdates.WithLabelValues(metrics.ResultError).Inc()
+		}
 		return fmt.Errorf("cni.handleClaim: failed to update resource claim status (%v): %v", result, err)
 	}
+	metrics.ClaimStatusUpdates.WithLabelValues(metrics.ResultSuccess).Inc()
 	return nil
 }
 
@@ -0,0 +1,28 @@
+package status
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// SinkClaimStatus writes the CNI results in the status of the
+	// ResourceClaims.
+	SinkClaimStatus = "claim-status"
+	// SinkEvents records Events on the pods and ResourceClaims when their
+	// networks are attached and detached.
+	SinkEvents = "events"
+)
+
+// Sinks are the sinks the status of the networks can be reported to.
+var Sinks = []string{SinkClaimStatus, SinkEvents}
+
+// ValidateSinks returns an error if a sink is unknown.
+func ValidateSinks(sinks []string) error {
+	for _, sink := range sinks {
+		if !slices.Contains(Sinks, sink) {
+			return fmt.Errorf("unknown status sink %q (supported: %v)", sink, Sinks)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Config of the trace exporter.
+type Config struct {
+	// Endpoint (host:port) of the OTLP gRPC collector.
+	Endpoint string
+	// Insecure disables the TLS of the connection to the collector.
+	Insecure bool
+	// SamplingRatio is the ratio of the traces sampled (from 0 to 1), the
+	// sampling decision of a parent span is followed.
+	SamplingRatio float64
+	// ServiceName identifies the process in the traces.
+	ServiceName string
+}
+
+// Setup sets the global tracer provider exporting the spans over OTLP. The
+// returned function flushes the pending spans and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	exporterOpts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(config.Endpoint),
+	}
+	if config.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the trace resource: %w", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SamplingRatio))),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return tracerProvider.Shutdown, nil
+}
@@ -0,0 +1,233 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ManifestError is an error of an object of a manifest, located by the line
+// of the invalid field.
+type ManifestError struct {
+	File      string
+	Line      int
+	Kind      string
+	Namespace string
+	Name      string
+	Field     string
+	Detail    string
+}
+
+func (e ManifestError) Error() string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + e.Name
+	}
+	return fmt.Sprintf("%s:%d: %s %s: %s: %s", e.File, e.Line, e.Kind, name, e.Field, e.Detail)
+}
+
+// ManifestOptions configures the validation of the manifests.
+type ManifestOptions struct {
+	DriverName string
+	// CNIPath lists the directories the CNI plugins must be found in (not
+	// checked if empty).
+	CNIPath []string
+}
+
+// manifestObject is the header of the objects of a manifest.
+type manifestObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+// ValidateManifest validates the opaque configs targeting the driver of the
+// ResourceClaims, ResourceClaimTemplates and DeviceClasses of the (multi
+// document) YAML or JSON manifest, the other objects are ignored.
+func ValidateManifest(file string, data []byte, opts ManifestOptions) ([]ManifestError, error) {
+	manifestErrs := []ManifestError{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		document := &yaml.Node{}
+		err := decoder.Decode(document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to parse: %w", file, err)
+		}
+
+		documentErrs, err := validateDocument(file, document, opts)
+		if err != nil {
+			return nil, err
+		}
+		manifestErrs = append(manifestErrs, documentErrs...)
+	}
+
+	return manifestErrs, nil
+}
+
+func validateDocument(file string, document *yaml.Node, opts ManifestOptions) ([]ManifestError, error) {
+	content := map[string]interface{}{}
+	if err := document.Decode(&content); err != nil {
+		return nil, fmt.Errorf("%s:%d: failed to decode: %w", file, document.Line, err)
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d: failed to convert to JSON: %w", file, document.Line, err)
+	}
+
+	header := manifestObject{}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("%s:%d: failed to decode: %w", file, document.Line, err)
+	}
+	if !strings.HasPrefix(header.APIVersion, resourcev1beta1.GroupName+"/") {
+		return nil, nil
+	}
+
+	allErrs, err := validateObject(header.Kind, raw, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d: failed to decode %s %s: %w", file, document.Line, header.Kind, header.Metadata.Name, err)
+	}
+
+	manifestErrs := make([]ManifestError, 0, len(allErrs))
+	for _, fieldErr := range allErrs {
+		manifestErrs = append(manifestErrs, ManifestError{
+			File:      file,
+			Line:      fieldLine(document, fieldErr.Field),
+			Kind:      header.Kind,
+			Namespace: header.Metadata.Namespace,
+			Name:      header.Metadata.Name,
+			Field:     fieldErr.Field,
+			Detail:    fieldErrorDetail(fieldErr),
+		})
+	}
+
+	return manifestErrs, nil
+}
+
+func validateObject(kind string, raw []byte, opts ManifestOptions) (field.ErrorList, error) {
+	allErrs := field.ErrorList{}
+
+	switch kind {
+	case "ResourceClaim":
+		claim := &resourcev1beta1.ResourceClaim{}
+		if err := json.Unmarshal(raw, claim); err != nil {
+			return nil, err
+		}
+		specPath := field.NewPath("spec")
+		allErrs = append(allErrs, ValidateClaimSpec(&claim.Spec, opts.DriverName, specPath)...)
+		allErrs = append(allErrs, validateClaimPlugins(&claim.Spec, opts, specPath)...)
+	case "ResourceClaimTemplate":
+		template := &resourcev1beta1.ResourceClaimTemplate{}
+		if err := json.Unmarshal(raw, template); err != nil {
+			return nil, err
+		}
+		specPath := field.NewPath("spec", "spec")
+		allErrs = append(allErrs, ValidateClaimSpec(&template.Spec.Spec, opts.DriverName, specPath)...)
+		allErrs = append(allErrs, validateClaimPlugins(&template.Spec.Spec, opts, specPath)...)
+	case "DeviceClass":
+		class := &resourcev1beta1.DeviceClass{}
+		if err := json.Unmarshal(raw, class); err != nil {
+			return nil, err
+		}
+		specPath := field.NewPath("spec")
+		allErrs = append(allErrs, ValidateDeviceClassSpec(&class.Spec, opts.DriverName, specPath)...)
+		if len(opts.CNIPath) > 0 {
+			for i, config := range class.Spec.Config {
+				allErrs = append(allErrs, ValidatePluginsInPath(config.Opaque, opts.DriverName, opts.CNIPath,
+					specPath.Child("config").Index(i).Child("opaque"))...)
+			}
+		}
+	}
+
+	return allErrs, nil
+}
+
+func validateClaimPlugins(spec *resourcev1beta1.ResourceClaimSpec, opts ManifestOptions, fldPath *field.Path) field.ErrorList {
+	if len(opts.CNIPath) == 0 {
+		return nil
+	}
+
+	allErrs := field.ErrorList{}
+	for i, config := range spec.Devices.Config {
+		allErrs = append(allErrs, ValidatePluginsInPath(config.Opaque, opts.DriverName, opts.CNIPath,
+			fldPath.Child("devices", "config").Index(i).Child("opaque"))...)
+	}
+
+	return allErrs
+}
+
+// fieldErrorDetail returns the message of the error without the field.
+func fieldErrorDetail(fieldErr *field.Error) string {
+	return strings.TrimPrefix(fieldErr.Error(), fieldErr.Field+": ")
+}
+
+var fieldSegment = regexp.MustCompile(`^([^\[]*)((?:\[\d+\])*)$`)
+
+// fieldLine returns the line of the deepest node of the document found for
+// the field path (e.g. spec.devices.config[0].opaque.parameters). The
+// parameters being an embedded JSON/YAML object, the path of an error in
+// the CNI config may go further than the manifest nodes.
+func fieldLine(document *yaml.Node, fieldPath string) int {
+	node := document
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+
+	for _, segment := range strings.Split(fieldPath, ".") {
+		match := fieldSegment.FindStringSubmatch(segment)
+		if match == nil {
+			return line
+		}
+
+		if match[1] != "" {
+			node = mappingValue(node, match[1])
+			if node == nil {
+				return line
+			}
+			line = node.Line
+		}
+
+		for _, index := range strings.FieldsFunc(match[2], func(r rune) bool { return r == '[' || r == ']' }) {
+			i, _ := strconv.Atoi(index)
+			if node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+		}
+	}
+
+	return line
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
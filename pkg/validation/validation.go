@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
+	cniv1 "github.com/kubernetes-sigs/multi-network/pkg/cni/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateClaimSpec validates the opaque configs of the claim spec targeting
+// the driver the same way the node decodes them before calling CNI.
+func ValidateClaimSpec(spec *resourcev1beta1.ResourceClaimSpec, driverName string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	configPath := fldPath.Child("devices", "config")
+	driverConfigs := 0
+
+	for i, config := range spec.Devices.Config {
+		if config.Opaque == nil || config.Opaque.Driver != driverName {
+			continue
+		}
+
+		driverConfigs++
+		if driverConfigs > 1 {
+			allErrs = append(allErrs, field.Forbidden(configPath.Index(i),
+				"only a single config per claim is supported for driver "+driverName))
+		}
+
+		allErrs = append(allErrs, ValidateOpaqueConfig(config.Opaque, driverName, configPath.Index(i).Child("opaque"))...)
+	}
+
+	return allErrs
+}
+
+// ValidateDeviceClassSpec validates the opaque configs of the device class
+// spec targeting the driver, they are merged with the claim ones on the
+// node.
+func ValidateDeviceClassSpec(spec *resourcev1beta1.DeviceClassSpec, driverName string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	configPath := fldPath.Child("config")
+
+	for i, config := range spec.Config {
+		allErrs = append(allErrs, ValidateOpaqueConfig(config.Opaque, driverName, configPath.Index(i).Child("opaque"))...)
+	}
+
+	return allErrs
+}
+
+// ValidateOpaqueConfig validates the parameters of the opaque config if it
+// targets the driver.
+func ValidateOpaqueConfig(opaque *resourcev1beta1.OpaqueDeviceConfiguration, driverName string, fldPath *field.Path) field.ErrorList {
+	if opaque == nil || opaque.Driver != driverName {
+		return nil
+	}
+
+	_, err := cniv1.ParseParameters(opaque.Parameters.Raw)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath.Child("parameters"), field.OmitValueType{}, err.Error())}
+	}
+
+	return nil
+}
+
+// ValidatePluginsInPath validates the CNI plugins (and IPAM plugins) of the
+// opaque config targeting the driver are found in the CNI paths.
+func ValidatePluginsInPath(opaque *resourcev1beta1.OpaqueDeviceConfiguration, driverName string, cniPath []string, fldPath *field.Path) field.ErrorList {
+	if opaque == nil || opaque.Driver != driverName {
+		return nil
+	}
+
+	parameters, err := cniv1.ParseParameters(opaque.Parameters.Raw)
+	if err != nil {
+		// Reported by ValidateOpaqueConfig.
+		return nil
+	}
+
+	confList, err := libcni.ConfListFromBytes(parameters.Config.Raw)
+	if err != nil {
+		return nil
+	}
+
+	allErrs := field.ErrorList{}
+	pluginsPath := fldPath.Child("parameters", "config", "plugins")
+
+	for i, plugin := range confList.Plugins {
+		pluginTypes := []string{plugin.Network.Type}
+		if plugin.Network.IPAM.Type != "" {
+			pluginTypes = append(pluginTypes, plugin.Network.IPAM.Type)
+		}
+
+		for _, pluginType := range pluginTypes {
+			if _, err := invoke.FindInPath(pluginType, cniPath); err != nil {
+				allErrs = append(allErrs, field.NotFound(pluginsPath.Index(i).Child("type"), pluginType))
+			}
+		}
+	}
+
+	return allErrs
+}
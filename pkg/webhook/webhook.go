@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/LionelJouin/network-dra/pkg/validation"
+	admissionv1 "k8s.io/api/admission/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+// maxRequestSize is the maximum size of an admission review request body.
+const maxRequestSize = 3 * 1024 * 1024
+
+// Validator is the validating admission webhook rejecting the
+// ResourceClaims and ResourceClaimTemplates with an invalid config for the
+// driver.
+type Validator struct {
+	DriverName string
+}
+
+// ServeHTTP handles an AdmissionReview request.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(review)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "admission review without request", http.StatusBadRequest)
+		return
+	}
+
+	response := v.review(review.Request)
+	response.UID = review.Request.UID
+
+	klog.FromContext(r.Context()).V(2).Info("admission review",
+		"kind", review.Request.Kind.Kind,
+		"object", klog.KRef(review.Request.Namespace, review.Request.Name),
+		"operation", review.Request.Operation,
+		"allowed", response.Allowed,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&admissionv1.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: response,
+	})
+	if err != nil {
+		klog.FromContext(r.Context()).Error(err, "failed to write admission review response")
+	}
+}
+
+func (v *Validator) review(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if len(request.Object.Raw) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	var allErrs field.ErrorList
+
+	switch request.Kind.Kind {
+	case "ResourceClaim":
+		claim := &resourcev1beta1.ResourceClaim{}
+		if err := json.Unmarshal(request.Object.Raw, claim); err != nil {
+			return deny(fmt.Sprintf("failed to decode ResourceClaim: %v", err))
+		}
+		allErrs = validation.ValidateClaimSpec(&claim.Spec, v.DriverName, field.NewPath("spec"))
+	case "ResourceClaimTemplate":
+		template := &resourcev1beta1.ResourceClaimTemplate{}
+		if err := json.Unmarshal(request.Object.Raw, template); err != nil {
+			return deny(fmt.Sprintf("failed to decode ResourceClaimTemplate: %v", err))
+		}
+		allErrs = validation.ValidateClaimSpec(&template.Spec.Spec, v.DriverName, field.NewPath("spec", "spec"))
+	default:
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	if len(allErrs) > 0 {
+		return deny(allErrs.ToAggregate().Error())
+	}
+
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func deny(message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusUnprocessableEntity,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: message,
+		},
+	}
+}
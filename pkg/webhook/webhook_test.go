@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testDriverName = "poc.dra.networking"
+
+// claimSpec returns a claim spec with the opaque parameters of the driver.
+func claimSpec(parameters string) string {
+	return `{"devices":{"requests":[{"name":"macvlan","deviceClassName":"network"}],` +
+		`"config":[{"requests":["macvlan"],"opaque":{"driver":"` + testDriverName + `","parameters":` + parameters + `}}]}}`
+}
+
+const (
+	validParameters   = `{"interface":"net1","config":{"cniVersion":"1.0.0","name":"macvlan","plugins":[{"type":"macvlan","master":"eth0"}]}}`
+	invalidParameters = `{"interface":"net1","config":{"cniVersion":"1.0.0","name":"macvlan"}}`
+)
+
+func TestServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        string
+		object      string
+		wantAllowed bool
+		wantMessage string
+	}{
+		{
+			name:        "valid claim",
+			kind:        "ResourceClaim",
+			object:      `{"metadata":{"name":"claim"},"spec":` + claimSpec(validParameters) + `}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid claim",
+			kind:        "ResourceClaim",
+			object:      `{"metadata":{"name":"claim"},"spec":` + claimSpec(invalidParameters) + `}`,
+			wantMessage: "spec.devices.config[0].opaque.parameters",
+		},
+		{
+			name:        "valid claim template",
+			kind:        "ResourceClaimTemplate",
+			object:      `{"metadata":{"name":"template"},"spec":{"spec":` + claimSpec(validParameters) + `}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid claim template",
+			kind:        "ResourceClaimTemplate",
+			object:      `{"metadata":{"name":"template"},"spec":{"spec":` + claimSpec(invalidParameters) + `}}`,
+			wantMessage: "spec.spec.devices.config[0].opaque.parameters",
+		},
+		{
+			name:        "undecodable claim",
+			kind:        "ResourceClaim",
+			object:      `{"spec":[]}`,
+			wantMessage: "failed to decode ResourceClaim",
+		},
+		{
+			name:        "other kind",
+			kind:        "DeviceClass",
+			object:      `{"metadata":{"name":"network"}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "no object",
+			kind:        "ResourceClaim",
+			wantAllowed: true,
+		},
+	}
+
+	validator := &Validator{DriverName: testDriverName}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var object []byte
+			if tt.object != "" {
+				object = []byte(tt.object)
+			}
+			request := &admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "review-uid",
+					Kind:      metav1.GroupVersionKind{Group: "resource.k8s.io", Version: "v1beta1", Kind: tt.kind},
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: object},
+				},
+			}
+			body, err := json.Marshal(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			validator.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("ServeHTTP() status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+			}
+
+			review := &admissionv1.AdmissionReview{}
+			err = json.Unmarshal(recorder.Body.Bytes(), review)
+			if err != nil {
+				t.Fatalf("failed to decode the response: %v", err)
+			}
+			if review.Kind != "AdmissionReview" || review.Response == nil || review.Response.UID != "review-uid" {
+				t.Fatalf("ServeHTTP() response = %s, want the response of review-uid", recorder.Body)
+			}
+			if review.Response.Allowed != tt.wantAllowed {
+				t.Errorf("ServeHTTP() allowed = %t, want %t", review.Response.Allowed, tt.wantAllowed)
+			}
+			if tt.wantMessage != "" && (review.Response.Result == nil || !strings.Contains(review.Response.Result.Message, tt.wantMessage)) {
+				t.Errorf("ServeHTTP() result = %+v, want a message containing %q", review.Response.Result, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestServeHTTPBadRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{name: "not a POST", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+		{name: "undecodable review", method: http.MethodPost, body: "{", wantStatus: http.StatusBadRequest},
+		{name: "review without request", method: http.MethodPost, body: `{"kind":"AdmissionReview"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	validator := &Validator{DriverName: testDriverName}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			validator.ServeHTTP(recorder, httptest.NewRequest(tt.method, "/validate", strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}